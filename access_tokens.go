@@ -0,0 +1,274 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// tokenScope is a part of the API a personal access token may be granted.
+// JWTs from a login are granted every scope.
+type tokenScope string
+
+const (
+	scopeChirpsRead   tokenScope = "chirps:read"
+	scopeChirpsWrite  tokenScope = "chirps:write"
+	scopeFollowsWrite tokenScope = "follows:write"
+	scopeProfileWrite tokenScope = "profile:write"
+)
+
+var tokenScopes = []tokenScope{
+	scopeChirpsRead,
+	scopeChirpsWrite,
+	scopeFollowsWrite,
+	scopeProfileWrite,
+}
+
+var errInsufficientScope = errors.New("token is not granted the required scope")
+
+// authenticate returns the user token stands for, if it is granted scope.
+// token is either a JWT, from a login or issued to an OAuth client, or a
+// personal access token.
+func authenticate(ctx context.Context, cfg *apiConfig, token string, scope tokenScope) (uuid.UUID, error) {
+	if !auth.IsAccessToken(token) {
+		claims, err := auth.ValidateAccessJWT(token, cfg.jwtKeys)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if len(claims.ClientID) > 0 && !slices.Contains(claims.Scopes, string(scope)) {
+			return uuid.Nil, fmt.Errorf("%w %v", errInsufficientScope, scope)
+		}
+		return claims.UserID, nil
+	}
+
+	accessToken, err := cfg.dbQueries.GetPersonalAccessTokenByHash(ctx, auth.HashAccessToken(token))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("personal access token is invalid: %w", err)
+	}
+	if !slices.Contains(accessToken.Scopes, string(scope)) {
+		return uuid.Nil, fmt.Errorf("%w %v", errInsufficientScope, scope)
+	}
+	if err := cfg.dbQueries.TouchPersonalAccessToken(ctx, accessToken.ID); err != nil {
+		log.Printf("Error in updating last use of personal access token: %v\n", err)
+	}
+	return accessToken.UserID, nil
+}
+
+// writeAuthenticationError responds to a request that failed authenticate
+// for scope.
+func writeAuthenticationError(w http.ResponseWriter, err error, scope tokenScope) {
+	if errors.Is(err, errInsufficientScope) {
+		// RFC 6750, section 3.1.
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+		jsonResponse(w, http.StatusForbidden, errorPayload{
+			Error: fmt.Sprintf("Token is not granted the %v scope", scope),
+		})
+		return
+	}
+	jsonResponse(w, http.StatusUnauthorized, errorPayload{
+		Error: "Unauthorized",
+	})
+}
+
+// NOTE: follows the generated model database.PersonalAccessToken
+type personalAccessToken struct {
+	ID         uuid.UUID    `json:"id"`
+	Name       string       `json:"name"`
+	Scopes     []tokenScope `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  *time.Time   `json:"expires_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+}
+
+func newPersonalAccessToken(t database.PersonalAccessToken) personalAccessToken {
+	response := personalAccessToken{
+		ID:        t.ID,
+		Name:      t.Name,
+		Scopes:    make([]tokenScope, 0, len(t.Scopes)),
+		CreatedAt: t.CreatedAt,
+	}
+	for _, scope := range t.Scopes {
+		response.Scopes = append(response.Scopes, tokenScope(scope))
+	}
+	if t.ExpiresAt.Valid {
+		response.ExpiresAt = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		response.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return response
+}
+
+// createAccessTokenHandler creates a personal access token. Managing tokens
+// takes a login, so that a token cannot be used to mint others.
+func createAccessTokenHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		Name      string       `json:"name"`
+		Scopes    []tokenScope `json:"scopes"`
+		ExpiresAt *time.Time   `json:"expires_at"`
+	}
+	type responsePayload struct {
+		personalAccessToken
+		// Token is only ever shown here.
+		Token string `json:"token"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST tokens: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("POST tokens: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST tokens: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(request.Name) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Name is required",
+		})
+		return
+	}
+	if len(request.Scopes) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "At least one scope is required",
+		})
+		return
+	}
+	scopes := make([]string, 0, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if !slices.Contains(tokenScopes, scope) {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: fmt.Sprintf("Unknown scope %q", scope),
+			})
+			return
+		}
+		if !slices.Contains(scopes, string(scope)) {
+			scopes = append(scopes, string(scope))
+		}
+	}
+	expiresAt := sql.NullTime{}
+	if request.ExpiresAt != nil {
+		if !request.ExpiresAt.After(time.Now()) {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Expiry must be in the future",
+			})
+			return
+		}
+		expiresAt = sql.NullTime{
+			Time:  request.ExpiresAt.UTC(),
+			Valid: true,
+		}
+	}
+
+	accessToken, err := auth.MakeAccessToken()
+	if err != nil {
+		log.Printf("POST tokens: error in creating token: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	created, err := cfg.dbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      request.Name,
+		TokenHash: auth.HashAccessToken(accessToken),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("POST tokens: error in storing token: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, responsePayload{
+		personalAccessToken: newPersonalAccessToken(created),
+		Token:               accessToken,
+	})
+}
+
+func listAccessTokensHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("GET tokens: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("GET tokens: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := cfg.dbQueries.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("GET tokens: error in getting tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]personalAccessToken, 0, len(tokens))
+	for _, t := range tokens {
+		response = append(response, newPersonalAccessToken(t))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+func revokeAccessTokenHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("DELETE token: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("DELETE token: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		log.Printf("DELETE token: error in parsing token ID: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid token ID",
+		})
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("DELETE token: error in revoking token: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
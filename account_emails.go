@@ -0,0 +1,377 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"ValenTheRed/chirpy/internal/mail"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	emailVerificationExpiresIn = 24 * time.Hour
+	passwordResetExpiresIn     = time.Hour
+)
+
+const tooManyEmailVerificationsMessage = "Too many verification emails, try again later"
+
+// oneTimeTokenEmail is the email a one-time token for a purpose is sent in.
+// Path is the page of the web app the link in it leads to.
+type oneTimeTokenEmail struct {
+	Subject   string
+	Text      string
+	Path      string
+	ExpiresIn time.Duration
+}
+
+var oneTimeTokenEmails = map[auth.TokenPurpose]oneTimeTokenEmail{
+	auth.PurposeVerifyEmail: {
+		Subject:   "Verify your Chirpy email",
+		Text:      "Confirm that this is your email by following the link below.",
+		Path:      "/app/verify-email",
+		ExpiresIn: emailVerificationExpiresIn,
+	},
+	auth.PurposeResetPassword: {
+		Subject:   "Reset your Chirpy password",
+		Text:      "Someone asked to reset the password of your Chirpy account. If it was you, follow the link below to choose a new one. Otherwise, you can ignore this email.",
+		Path:      "/app/reset-password",
+		ExpiresIn: passwordResetExpiresIn,
+	},
+}
+
+// sendOneTimeTokenEmail emails u a one-time token for purpose.
+func sendOneTimeTokenEmail(
+	ctx context.Context,
+	cfg *apiConfig,
+	u database.User,
+	purpose auth.TokenPurpose,
+) error {
+	email := oneTimeTokenEmails[purpose]
+	token, tokenID, err := auth.MakeOneTimeJWT(u.ID, cfg.jwtKeys, purpose, email.ExpiresIn)
+	if err != nil {
+		return err
+	}
+	if err := cfg.dbQueries.CreateOneTimeToken(ctx, database.CreateOneTimeTokenParams{
+		ID:               tokenID,
+		UserID:           u.ID,
+		Purpose:          string(purpose),
+		Email:            u.Email.String,
+		ExpiresInSeconds: email.ExpiresIn.Seconds(),
+	}); err != nil {
+		return err
+	}
+
+	link := cfg.publicURL + email.Path + "?" + url.Values{"token": {token}}.Encode()
+	return cfg.mailer.Send(ctx, mail.Message{
+		To:      u.Email.String,
+		Subject: email.Subject,
+		Body: fmt.Sprintf(
+			"%s\n\n%s\n\nThe link expires in %v.\n",
+			email.Text,
+			link,
+			email.ExpiresIn,
+		),
+	})
+}
+
+// sendOneTimeTokenEmailInBackground is sendOneTimeTokenEmail without
+// holding up the response, which also keeps its timing from giving away
+// whether an email was sent at all.
+func sendOneTimeTokenEmailInBackground(
+	ctx context.Context,
+	cfg *apiConfig,
+	u database.User,
+	purpose auth.TokenPurpose,
+) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := sendOneTimeTokenEmail(ctx, cfg, u, purpose); err != nil {
+			log.Printf("Error in sending %v email to user %v: %v\n", purpose, u.ID, err)
+		}
+	}()
+}
+
+// useOneTimeToken validates tokenString for purpose and marks it as used.
+// It returns sql.ErrNoRows if the token was used before or has expired.
+func useOneTimeToken(
+	ctx context.Context,
+	cfg *apiConfig,
+	q *database.Queries,
+	tokenString string,
+	purpose auth.TokenPurpose,
+) (database.OneTimeToken, error) {
+	userID, tokenID, err := auth.ValidateOneTimeJWT(tokenString, cfg.jwtKeys, purpose)
+	if err != nil {
+		return database.OneTimeToken{}, err
+	}
+	token, err := q.UseOneTimeToken(ctx, database.UseOneTimeTokenParams{
+		ID:      tokenID,
+		Purpose: string(purpose),
+	})
+	if err != nil {
+		return database.OneTimeToken{}, err
+	}
+	if token.UserID != userID {
+		return database.OneTimeToken{}, sql.ErrNoRows
+	}
+	return token, nil
+}
+
+func requestEmailVerificationHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST email verification request: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("POST email verification request: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	requester, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("POST email verification request: error in getting user: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if requester.EmailVerifiedAt.Valid {
+		jsonResponse(w, http.StatusConflict, errorPayload{
+			Error: "Email is already verified",
+		})
+		return
+	}
+
+	retryAfter, err := countThrottledRequest(r.Context(), cfg, emailVerificationThrottle(requester.ID), ipEmailVerificationThrottle(r))
+	if err != nil {
+		log.Printf("POST email verification request: error in throttling request: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		writeRequestLockout(w, retryAfter, tooManyEmailVerificationsMessage)
+		return
+	}
+
+	if err := sendOneTimeTokenEmail(r.Context(), cfg, requester, auth.PurposeVerifyEmail); err != nil {
+		log.Printf("POST email verification request: error in sending email: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func confirmEmailVerificationHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		Token string `json:"token"`
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST email verification confirm: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("POST email verification confirm: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	token, err := useOneTimeToken(r.Context(), cfg, qtx, request.Token, auth.PurposeVerifyEmail)
+	if err != nil {
+		log.Printf("POST email verification confirm: error in using token: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Invalid or expired token",
+		})
+		return
+	}
+	// The email is matched too, so that a token sent to an old email
+	// does not verify a new one.
+	verified, err := qtx.MarkUserEmailVerified(r.Context(), database.MarkUserEmailVerifiedParams{
+		ID: token.UserID,
+		Email: sql.NullString{
+			String: token.Email,
+			Valid:  true,
+		},
+	})
+	if err != nil {
+		log.Printf("POST email verification confirm: error in verifying email: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if verified == 0 {
+		jsonResponse(w, http.StatusConflict, errorPayload{
+			Error: "Email has changed since the token was sent",
+		})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("POST email verification confirm: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestPasswordResetHandler emails a password reset token to the given
+// email. It answers the same whether or not an account has that email.
+// Requests are throttled per email and per IP, the same way failed logins
+// are, whether or not they send anything.
+func requestPasswordResetHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		Email string `json:"email"`
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST password reset request: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	retryAfter, err := countThrottledRequest(r.Context(), cfg, passwordResetThrottle(request.Email), ipPasswordResetThrottle(r))
+	if err != nil {
+		log.Printf("POST password reset request: error in throttling request: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		writeRequestLockout(w, retryAfter, "Too many password reset requests, try again later")
+		return
+	}
+
+	requester, err := cfg.dbQueries.GetUser(r.Context(), sql.NullString{
+		String: request.Email,
+		Valid:  true,
+	})
+	if err == nil {
+		sendOneTimeTokenEmailInBackground(r.Context(), cfg, requester, auth.PurposeResetPassword)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("POST password reset request: error in finding user: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// confirmPasswordResetHandler sets a new password with a password reset
+// token. As whoever knew the old password may still be logged in, every
+// session of the user is revoked, along with their personal access tokens.
+func confirmPasswordResetHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST password reset confirm: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(request.Password) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Password is required",
+		})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(request.Password, cfg.passwordParams)
+	if err != nil {
+		log.Printf("POST password reset confirm: error in hashing password: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("POST password reset confirm: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	token, err := useOneTimeToken(r.Context(), cfg, qtx, request.Token, auth.PurposeResetPassword)
+	if err != nil {
+		log.Printf("POST password reset confirm: error in using token: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Invalid or expired token",
+		})
+		return
+	}
+	requester, err := qtx.GetUserByID(r.Context(), token.UserID)
+	if err != nil {
+		log.Printf("POST password reset confirm: error in getting user: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if requester.Email.String != token.Email {
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Invalid or expired token",
+		})
+		return
+	}
+
+	if err := qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             requester.ID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		log.Printf("POST password reset confirm: error in updating password: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Any other reset token is as good as the old password now.
+	if err := qtx.UseAllOneTimeTokens(r.Context(), database.UseAllOneTimeTokensParams{
+		UserID:  requester.ID,
+		Purpose: string(auth.PurposeResetPassword),
+	}); err != nil {
+		log.Printf("POST password reset confirm: error in using other tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := qtx.RevokeAllSessions(r.Context(), requester.ID); err != nil {
+		log.Printf("POST password reset confirm: error in revoking sessions: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := qtx.RevokeAllRefreshTokens(r.Context(), uuid.NullUUID{
+		UUID:  requester.ID,
+		Valid: true,
+	}); err != nil {
+		log.Printf("POST password reset confirm: error in revoking refresh tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := qtx.RevokeAllPersonalAccessTokens(r.Context(), requester.ID); err != nil {
+		log.Printf("POST password reset confirm: error in revoking personal access tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("POST password reset confirm: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// authenticateAdmin checks that r carries the admin API key. Admin
+// endpoints are unavailable when no key is configured.
+func authenticateAdmin(cfg *apiConfig, r *http.Request) error {
+	if len(cfg.adminApiKey) == 0 {
+		return errors.New("admin API key is not configured")
+	}
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.adminApiKey)) != 1 {
+		return errors.New("admin API key does not match")
+	}
+	return nil
+}
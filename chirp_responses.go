@@ -0,0 +1,187 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// newChirp converts a chirp from the database into its API model. Fields
+// that are not stored on the chirp itself are left for chirpsResponse to
+// fill.
+func newChirp(c database.Chirp) chirp {
+	response := chirp{
+		ID:        c.ID,
+		UserID:    c.UserID.UUID,
+		Body:      c.Body.String,
+		CreatedAt: c.CreatedAt.Time,
+		UpdatedAt: c.UpdatedAt.Time,
+	}
+	if c.InReplyTo.Valid {
+		response.InReplyTo = &c.InReplyTo.UUID
+	}
+	response.Mentions = []chirpMention{}
+	response.Media = []media{}
+	return response
+}
+
+// chirpsResponseOptions tailors the API model of chirps to the caller.
+type chirpsResponseOptions struct {
+	// ViewerID is the authenticated caller, if any. LikedByMe is only set
+	// when it is valid.
+	ViewerID uuid.NullUUID
+	// EmbedAuthor embeds a compact profile of each chirp's author.
+	EmbedAuthor bool
+}
+
+// newChirpsResponseOptions returns the options requested by r. Clients
+// ask for authors with `?expand=author`.
+func newChirpsResponseOptions(r *http.Request, viewerID uuid.NullUUID) chirpsResponseOptions {
+	expand := strings.Split(r.URL.Query().Get("expand"), ",")
+	return chirpsResponseOptions{
+		ViewerID:    viewerID,
+		EmbedAuthor: slices.Contains(expand, "author"),
+	}
+}
+
+// chirpsResponse converts chirps into their API model. Aggregates such as
+// reply and like counts, mentions, media and the embedded authors are
+// fetched for all chirps at once rather than per chirp.
+func chirpsResponse(
+	ctx context.Context,
+	cfg *apiConfig,
+	opts chirpsResponseOptions,
+	chirps []database.Chirp,
+) ([]chirp, error) {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	authorIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+		authorIDs = append(authorIDs, c.UserID.UUID)
+	}
+
+	replyCounts := map[uuid.UUID]int64{}
+	likeStats := map[uuid.UUID]database.GetChirpLikeStatsRow{}
+	if len(ids) > 0 {
+		replyRows, err := cfg.dbQueries.CountChirpReplies(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("error in counting replies: %w", err)
+		}
+		for _, row := range replyRows {
+			replyCounts[row.InReplyTo.UUID] = row.ReplyCount
+		}
+
+		likeRows, err := cfg.dbQueries.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{
+			ViewerID: opts.ViewerID,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error in counting likes: %w", err)
+		}
+		for _, row := range likeRows {
+			likeStats[row.ChirpID] = row
+		}
+	}
+
+	mentions := map[uuid.UUID][]chirpMention{}
+	if len(ids) > 0 {
+		mentionRows, err := cfg.dbQueries.GetChirpMentions(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("error in retrieving mentions: %w", err)
+		}
+		for _, row := range mentionRows {
+			mention := chirpMention{
+				UserID: row.UserID,
+				Start:  row.StartOffset,
+				End:    row.EndOffset,
+			}
+			if row.Handle.Valid {
+				mention.Handle = &row.Handle.String
+			}
+			mentions[row.ChirpID] = append(mentions[row.ChirpID], mention)
+		}
+	}
+
+	attachments := map[uuid.UUID][]media{}
+	if len(ids) > 0 {
+		mediaRows, err := cfg.dbQueries.GetChirpMedia(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("error in retrieving media: %w", err)
+		}
+		for _, row := range mediaRows {
+			attachments[row.ChirpID.UUID] = append(attachments[row.ChirpID.UUID], newMedia(cfg, row))
+		}
+	}
+
+	authors := map[uuid.UUID]chirpAuthor{}
+	if opts.EmbedAuthor && len(authorIDs) > 0 {
+		authorRows, err := cfg.dbQueries.GetChirpAuthors(ctx, authorIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error in retrieving authors: %w", err)
+		}
+		for _, row := range authorRows {
+			author := chirpAuthor{
+				ID:          row.ID,
+				DisplayName: row.DisplayName,
+			}
+			if row.Handle.Valid {
+				author.Handle = &row.Handle.String
+			}
+			authors[row.ID] = author
+		}
+	}
+
+	response := make([]chirp, 0, len(chirps))
+	for _, c := range chirps {
+		item := newChirp(c)
+		item.ReplyCount = replyCounts[c.ID]
+		item.LikeCount = likeStats[c.ID].LikeCount
+		if opts.ViewerID.Valid {
+			likedByMe := likeStats[c.ID].LikedByViewer
+			item.LikedByMe = &likedByMe
+		}
+		if author, ok := authors[c.UserID.UUID]; ok {
+			item.Author = &author
+		}
+		if chirpMentions, ok := mentions[c.ID]; ok {
+			item.Mentions = chirpMentions
+		}
+		if chirpMedia, ok := attachments[c.ID]; ok {
+			item.Media = chirpMedia
+		}
+		response = append(response, item)
+	}
+	return response, nil
+}
+
+// optionalBearerUserID returns the ID of the user the request's bearer
+// token belongs to, which must be granted the chirps:read scope. A request
+// without a token, or with one that fails authentication, is treated as
+// anonymous and gives an invalid ID, as the endpoints that use it do not
+// require authentication.
+func optionalBearerUserID(cfg *apiConfig, r *http.Request) uuid.NullUUID {
+	if len(r.Header.Get("Authorization")) == 0 {
+		return uuid.NullUUID{}
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("Error in getting optional bearer token: %v\n", err)
+		return uuid.NullUUID{}
+	}
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsRead)
+	if err != nil {
+		log.Printf("Error in authenticating optional bearer token: %v\n", err)
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{
+		UUID:  userID,
+		Valid: true,
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func listChirpRevisionsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayloadItem chirpRevision
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("GET chirp revisions: error while parsing chirp ID: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid chirp ID",
+		})
+		return
+	}
+
+	if _, err := cfg.dbQueries.GetChirp(r.Context(), chirpID); errors.Is(err, sql.ErrNoRows) {
+		jsonResponse(w, http.StatusNotFound, errorPayload{
+			Error: "Chirp not found",
+		})
+		return
+	} else if err != nil {
+		log.Printf("GET chirp revisions: error in retrieving chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := cfg.dbQueries.GetChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("GET chirp revisions: error in retrieving revisions: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]responsePayloadItem, 0, len(revisions))
+	for _, revision := range revisions {
+		response = append(response, responsePayloadItem{
+			ID:        revision.ID,
+			ChirpID:   revision.ChirpID,
+			Body:      revision.Body,
+			CreatedAt: revision.CreatedAt,
+		})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	// outboxEventsChannel is what new outbox events are notified on, see
+	// the outbox_events_notify trigger.
+	outboxEventsChannel = "outbox_events"
+	// chirpStreamBuffer is how many events a stream can fall behind by
+	// before it is closed. The client resumes it with Last-Event-ID.
+	chirpStreamBuffer = 64
+	// chirpStreamKeepAlive is how often a stream that has nothing to send
+	// sends a comment, so that proxies do not close it.
+	chirpStreamKeepAlive = 30 * time.Second
+	// chirpStreamBackfill is how many events are read at a time.
+	chirpStreamBackfill = 100
+	// chirpStreamPoll is how often the outbox is read even when nothing is
+	// notified, to pick up events held back behind an older transaction.
+	chirpStreamPoll = time.Second
+	// chirpStreamMaxSubscribers is how many streams a server keeps open at
+	// once, and chirpStreamMaxPerIP how many of those one address can.
+	chirpStreamMaxSubscribers = 1000
+	chirpStreamMaxPerIP       = 5
+)
+
+var errTooManyChirpStreams = errors.New("too many chirp streams open")
+
+// chirpStreamEvents are the outbox events sent on chirp streams.
+var chirpStreamEvents = []string{string(outboxChirpCreated), string(outboxChirpDeleted)}
+
+// chirpStreamEvent is an event as it is sent on chirp streams. One
+// without a Type is a watermark, which only moves the stream's id on to ID.
+type chirpStreamEvent struct {
+	Seq int64
+	// ID is the watermark the event was read from, and is sent as its id:
+	// a stream resumed from it is sent every event recorded since.
+	ID       int64
+	Type     outboxEvent
+	AuthorID uuid.UUID
+	// Hashtags are those of a created chirp. They are not known for
+	// deleted ones.
+	Hashtags []string
+	Data     []byte
+}
+
+// chirpStreamFilter picks the events a stream is sent.
+type chirpStreamFilter struct {
+	AuthorID uuid.NullUUID
+	Hashtag  string
+}
+
+// matches reports whether e passes f. Deletions pass the hashtag filter,
+// as the hashtags of a deleted chirp are gone; clients ignore deletions of
+// chirps they do not have.
+func (f chirpStreamFilter) matches(e chirpStreamEvent) bool {
+	if len(e.Type) == 0 {
+		return true
+	}
+	if f.AuthorID.Valid && e.AuthorID != f.AuthorID.UUID {
+		return false
+	}
+	if len(f.Hashtag) > 0 && e.Type == outboxChirpCreated {
+		return slices.Contains(e.Hashtags, f.Hashtag)
+	}
+	return true
+}
+
+// chirpStream fans out the chirp events of every server, which it learns
+// of through LISTEN/NOTIFY, to the streams open on this one.
+type chirpStream struct {
+	cfg *apiConfig
+
+	mu sync.Mutex
+	// subscribers maps each stream to the address it is open from, and
+	// perIP counts those.
+	subscribers map[chan chirpStreamEvent]string
+	perIP       map[string]int
+	// watermark is where the next events are read from. Only listen uses
+	// it.
+	watermark int64
+}
+
+func newChirpStream(cfg *apiConfig) *chirpStream {
+	return &chirpStream{
+		cfg:         cfg,
+		subscribers: map[chan chirpStreamEvent]string{},
+		perIP:       map[string]int{},
+	}
+}
+
+// subscribe returns a channel of new events for a stream open from ip,
+// which is closed when the subscriber falls too far behind, and a function
+// to unsubscribe with. It returns errTooManyChirpStreams when the server or
+// ip already has as many streams open as allowed.
+func (s *chirpStream) subscribe(ip string) (<-chan chirpStreamEvent, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subscribers) >= chirpStreamMaxSubscribers || s.perIP[ip] >= chirpStreamMaxPerIP {
+		return nil, nil, errTooManyChirpStreams
+	}
+	events := make(chan chirpStreamEvent, chirpStreamBuffer)
+	s.subscribers[events] = ip
+	s.perIP[ip]++
+	return events, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.remove(events)
+	}, nil
+}
+
+// remove closes the channel of a subscriber, if it is still subscribed.
+// s.mu is expected to be held.
+func (s *chirpStream) remove(subscriber chan chirpStreamEvent) {
+	ip, ok := s.subscribers[subscriber]
+	if !ok {
+		return
+	}
+	delete(s.subscribers, subscriber)
+	if s.perIP[ip]--; s.perIP[ip] == 0 {
+		delete(s.perIP, ip)
+	}
+	close(subscriber)
+}
+
+func (s *chirpStream) broadcast(events []chirpStreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		for subscriber := range s.subscribers {
+			select {
+			case subscriber <- e:
+			default:
+				// Rather than hold up everyone else, the subscriber is
+				// dropped, and resumes from the last event it got.
+				s.remove(subscriber)
+			}
+		}
+	}
+}
+
+// listen broadcasts the events recorded on the database at dbURL until the
+// process exits. Events are read up to the watermark, and so not before
+// every transaction that could still record an earlier one is over; the
+// notifications only tell listen to read sooner.
+func (s *chirpStream) listen(dbURL string) {
+	ctx := context.Background()
+	// Streams are sent events from here on, and not those before.
+	watermark, err := s.cfg.dbQueries.GetOutboxWatermark(ctx)
+	for err != nil {
+		log.Printf("Error in getting outbox watermark: %v\n", err)
+		time.Sleep(5 * time.Second)
+		watermark, err = s.cfg.dbQueries.GetOutboxWatermark(ctx)
+	}
+	s.watermark = watermark
+
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Error in listening for outbox events: %v\n", err)
+		}
+	})
+	// Listen fails only when the server refuses it, in which case events
+	// would only be polled for, so it is retried until it succeeds.
+	err = listener.Listen(outboxEventsChannel)
+	for err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+		log.Printf("Error in listening for outbox events: %v\n", err)
+		time.Sleep(5 * time.Second)
+		err = listener.Listen(outboxEventsChannel)
+	}
+	// Events recorded while Listen was being retried were not notified.
+	if err := s.catchUp(ctx); err != nil {
+		log.Printf("Error in broadcasting chirp events: %v\n", err)
+	}
+
+	poll := time.NewTicker(chirpStreamPoll)
+	defer poll.Stop()
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-listener.Notify:
+			// Whatever else is already notified is read along with it.
+			for len(listener.Notify) > 0 {
+				<-listener.Notify
+			}
+		case <-poll.C:
+		case <-ping.C:
+			go listener.Ping()
+			continue
+		}
+		if err := s.catchUp(ctx); err != nil {
+			log.Printf("Error in broadcasting chirp events: %v\n", err)
+		}
+	}
+}
+
+// catchUp broadcasts the events from the watermark up to the current one.
+// If it fails partway, the events are broadcast again on the next try.
+func (s *chirpStream) catchUp(ctx context.Context) error {
+	watermark, err := s.cfg.dbQueries.GetOutboxWatermark(ctx)
+	if err != nil {
+		return fmt.Errorf("error in getting outbox watermark: %w", err)
+	}
+	if watermark <= s.watermark {
+		return nil
+	}
+	err = readChirpStreamEvents(ctx, s.cfg, s.watermark, watermark, func(events []chirpStreamEvent) error {
+		s.broadcast(events)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.watermark = watermark
+	return nil
+}
+
+// readChirpStreamEvents reads the chirp events recorded from watermark from
+// up to watermark to, and passes them to send a page at a time, followed
+// by the watermark to.
+func readChirpStreamEvents(ctx context.Context, cfg *apiConfig, from, to int64, send func([]chirpStreamEvent) error) error {
+	afterSeq := int64(0)
+	for {
+		stored, err := cfg.dbQueries.ListOutboxEventsBetween(ctx, database.ListOutboxEventsBetweenParams{
+			FromXid:    from,
+			BeforeXid:  to,
+			AfterSeq:   afterSeq,
+			EventTypes: chirpStreamEvents,
+			RowLimit:   chirpStreamBackfill,
+		})
+		if err != nil {
+			return fmt.Errorf("error in getting events: %w", err)
+		}
+		if len(stored) == 0 {
+			break
+		}
+		events, err := newChirpStreamEvents(ctx, cfg, stored)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			events[i].ID = from
+		}
+		if err := send(events); err != nil {
+			return err
+		}
+		afterSeq = stored[len(stored)-1].Seq
+	}
+	return send([]chirpStreamEvent{{ID: to}})
+}
+
+// newChirpStreamEvents converts the chirp events among stored. Created
+// chirps are sent as they are listed, with their author embedded.
+func newChirpStreamEvents(ctx context.Context, cfg *apiConfig, stored []database.OutboxEvent) ([]chirpStreamEvent, error) {
+	events := []chirpStreamEvent{}
+	created := []database.Chirp{}
+	for _, e := range stored {
+		if !slices.Contains(chirpStreamEvents, e.EventType) {
+			continue
+		}
+		data := webhookChirp{}
+		if err := json.Unmarshal(e.Payload, &data); err != nil {
+			return nil, fmt.Errorf("error in decoding event %v: %w", e.Seq, err)
+		}
+		event := chirpStreamEvent{
+			Seq:      e.Seq,
+			Type:     outboxEvent(e.EventType),
+			AuthorID: data.UserID,
+		}
+		if event.Type == outboxChirpCreated {
+			event.Hashtags = extractHashtags(data.Body)
+			c := database.Chirp{
+				ID:        data.ID,
+				UserID:    uuid.NullUUID{UUID: data.UserID, Valid: true},
+				CreatedAt: sql.NullTime{Time: data.CreatedAt, Valid: true},
+				UpdatedAt: sql.NullTime{Time: data.CreatedAt, Valid: true},
+				Body:      sql.NullString{String: data.Body, Valid: true},
+			}
+			if data.InReplyTo != nil {
+				c.InReplyTo = uuid.NullUUID{UUID: *data.InReplyTo, Valid: true}
+			}
+			created = append(created, c)
+		} else {
+			event.Data = e.Payload
+		}
+		events = append(events, event)
+	}
+
+	if len(created) > 0 {
+		chirps, err := chirpsResponse(ctx, cfg, chirpsResponseOptions{EmbedAuthor: true}, created)
+		if err != nil {
+			return nil, err
+		}
+		i := 0
+		for j := range events {
+			if events[j].Type != outboxChirpCreated {
+				continue
+			}
+			events[j].Data, err = json.Marshal(chirps[i])
+			if err != nil {
+				return nil, fmt.Errorf("error in encoding chirp: %w", err)
+			}
+			i++
+		}
+	}
+	return events, nil
+}
+
+// streamChirpsHandler streams chirps as they are created and deleted, as
+// Server-Sent Events, optionally only those by `?author_id=` or with
+// `?hashtag=`. A client that reconnects with Last-Event-ID is first sent
+// what it missed. Events may be sent more than once, so clients go by the
+// chirp ID rather than count them.
+func streamChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Printf("GET chirp stream: response cannot be flushed\n")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := chirpStreamFilter{
+		Hashtag: strings.ToLower(strings.TrimPrefix(query.Get("hashtag"), "#")),
+	}
+	if s := query.Get("author_id"); len(s) > 0 {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Invalid author_id",
+			})
+			return
+		}
+		filter.AuthorID = uuid.NullUUID{
+			UUID:  id,
+			Valid: true,
+		}
+	}
+	var lastEventID int64
+	if s := r.Header.Get("Last-Event-ID"); len(s) > 0 {
+		var err error
+		lastEventID, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || lastEventID < 0 {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Invalid Last-Event-ID",
+			})
+			return
+		}
+	}
+
+	// The subscription comes before the backfill, so that nothing created
+	// in between is missed.
+	events, unsubscribe, err := cfg.chirpStream.subscribe(remoteIP(r))
+	if errors.Is(err, errTooManyChirpStreams) {
+		jsonResponse(w, http.StatusServiceUnavailable, errorPayload{
+			Error: "Too many chirp streams are open, try again later",
+		})
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Ids never go back, so that a stream resumed from any of them is
+	// not sent less than it was before. An event read from an earlier
+	// watermark than one already sent is sent with the later one, as
+	// everything in between was sent too.
+	sentID := int64(0)
+	send := func(e chirpStreamEvent) error {
+		if !filter.matches(e) || (len(e.Type) == 0 && e.ID <= sentID) {
+			return nil
+		}
+		sentID = max(sentID, e.ID)
+		var err error
+		if len(e.Type) == 0 {
+			_, err = fmt.Fprintf(w, "id: %d\n\n", sentID)
+		} else {
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", sentID, e.Type, e.Data)
+		}
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	backfilled := map[int64]bool{}
+	if lastEventID > 0 {
+		watermark, err := cfg.dbQueries.GetOutboxWatermark(r.Context())
+		if err != nil {
+			log.Printf("GET chirp stream: error in getting outbox watermark: %v\n", err)
+			return
+		}
+		if watermark > lastEventID {
+			err = readChirpStreamEvents(r.Context(), cfg, lastEventID, watermark, func(missed []chirpStreamEvent) error {
+				for _, e := range missed {
+					if err := send(e); err != nil {
+						return err
+					}
+					if len(e.Type) > 0 {
+						backfilled[e.Seq] = true
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				log.Printf("GET chirp stream: error in sending missed events: %v\n", err)
+				return
+			}
+		}
+	}
+
+	keepAlive := time.NewTicker(chirpStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(e.Type) > 0 && backfilled[e.Seq] {
+				continue
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
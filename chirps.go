@@ -3,20 +3,23 @@ package main
 import (
 	"ValenTheRed/chirpy/internal/auth"
 	"ValenTheRed/chirpy/internal/database"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"regexp"
-	"slices"
+	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
 
 const (
-	maxChirpLength     = 140
 	profaneReplacement = "****"
 
 	ascendingSort  = "asc"
@@ -25,9 +28,73 @@ const (
 
 var profanePattern = regexp.MustCompile(`(?i)(kerfuffle|sharbert|fornax)`)
 
+var errChirpTooLong = errors.New("chirp is too long")
+
+// cleanChirpBody checks that body is at most maxLength runes and masks its
+// profane words. Mentions of the users in mentioned, as returned by
+// resolveMentions, are left as is so that they still resolve, and are
+// returned with their offsets in the cleaned body. Anything else that looks
+// like a mention is masked as usual, and is not a mention afterwards even
+// if masking leaves a handle behind.
+func cleanChirpBody(body string, maxLength int, mentioned map[string]uuid.UUID) (string, []mentionSpan, error) {
+	if utf8.RuneCountInString(body) > maxLength {
+		return "", nil, errChirpTooLong
+	}
+	var cleaned strings.Builder
+	mentions := []mentionSpan{}
+	last := 0
+	for _, span := range findMentions(body) {
+		userID, ok := mentioned[strings.ToLower(span.Handle)]
+		// Handles cannot be profane, but one from before they were checked
+		// is masked rather than kept.
+		if !ok || profanePattern.MatchString(span.Handle) {
+			continue
+		}
+		cleaned.WriteString(profanePattern.ReplaceAllString(body[last:span.Start], profaneReplacement))
+		start := cleaned.Len()
+		cleaned.WriteString(body[span.Start:span.End])
+		mentions = append(mentions, mentionSpan{
+			Handle: span.Handle,
+			Start:  start,
+			End:    cleaned.Len(),
+			UserID: userID,
+		})
+		last = span.End
+	}
+	cleaned.WriteString(profanePattern.ReplaceAllString(body[last:], profaneReplacement))
+	return cleaned.String(), mentions, nil
+}
+
+// indexChirpBody stores what is parsed out of a chirp's body, such as its
+// hashtags and mentions, so that the chirp can be looked up by them.
+// Mentions are those cleanChirpBody returned for the body. q is expected to
+// be within the transaction that wrote the chirp.
+func indexChirpBody(ctx context.Context, q *database.Queries, c database.Chirp, mentions []mentionSpan) error {
+	if err := indexChirpHashtags(ctx, q, c); err != nil {
+		return fmt.Errorf("error in indexing hashtags: %w", err)
+	}
+	if err := indexChirpMentions(ctx, q, c, mentions); err != nil {
+		return fmt.Errorf("error in indexing mentions: %w", err)
+	}
+	return nil
+}
+
+// unindexChirpBody removes what indexChirpBody stored for a chirp.
+func unindexChirpBody(ctx context.Context, q *database.Queries, chirpID uuid.UUID) error {
+	if err := q.DeleteChirpHashtags(ctx, chirpID); err != nil {
+		return fmt.Errorf("error in removing hashtags: %w", err)
+	}
+	if err := q.DeleteChirpMentions(ctx, chirpID); err != nil {
+		return fmt.Errorf("error in removing mentions: %w", err)
+	}
+	return nil
+}
+
 func createChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 	type requestPayload struct {
-		Body string `json:"body"`
+		Body      string      `json:"body"`
+		InReplyTo *uuid.UUID  `json:"in_reply_to"`
+		MediaIDs  []uuid.UUID `json:"media_ids"`
 	}
 
 	type responsePayload chirp
@@ -40,11 +107,17 @@ func createChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsWrite)
 	if err != nil {
-		log.Printf("Error in validating token: %v\n", err)
-		jsonResponse(w, http.StatusUnauthorized, errorPayload{
-			Error: "Unauthorized",
+		log.Printf("Error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeChirpsWrite)
+		return
+	}
+	limits, err := userLimits(r.Context(), cfg, userID)
+	if err != nil {
+		log.Printf("Error in getting limits: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
 		})
 		return
 	}
@@ -58,15 +131,84 @@ func createChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if utf8.RuneCountInString(request.Body) > maxChirpLength {
+	mentioned, err := resolveMentions(r.Context(), cfg.dbQueries, request.Body)
+	if err != nil {
+		log.Printf("Error in resolving mentions: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	cleanedBody, mentions, err := cleanChirpBody(request.Body, limits.MaxChirpLength, mentioned)
+	if err != nil {
 		jsonResponse(w, http.StatusBadRequest, errorPayload{
 			Error: "Chirp is too long",
 		})
 		return
 	}
+	mediaIDs := request.MediaIDs
+	distinctMediaIDs := map[uuid.UUID]bool{}
+	for _, id := range mediaIDs {
+		distinctMediaIDs[id] = true
+	}
+	if len(mediaIDs) > limits.MaxChirpMedia || len(distinctMediaIDs) != len(mediaIDs) {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: fmt.Sprintf("A chirp can have up to %d distinct media", limits.MaxChirpMedia),
+		})
+		return
+	}
 
-	cleanedBody := profanePattern.ReplaceAllString(request.Body, profaneReplacement)
-	chirp, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
+	var inReplyTo uuid.NullUUID
+	if request.InReplyTo != nil {
+		inReplyTo = uuid.NullUUID{
+			UUID:  *request.InReplyTo,
+			Valid: true,
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// The user is locked for the rest of the transaction, so that chirps
+	// written at the same time are counted against the limit one by one.
+	if err := qtx.LockUser(r.Context(), userID); err != nil {
+		log.Printf("Error locking user: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	recent, err := qtx.CountRecentChirps(r.Context(), database.CountRecentChirpsParams{
+		WindowSeconds: chirpRateWindow.Seconds(),
+		UserID: uuid.NullUUID{
+			UUID:  userID,
+			Valid: true,
+		},
+	})
+	if err != nil {
+		log.Printf("Error counting recent chirps: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	if recent.ChirpCount >= int64(limits.ChirpsPerHour) {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(recent.RetryAfterSeconds))))
+		jsonResponse(w, http.StatusTooManyRequests, errorPayload{
+			Error: fmt.Sprintf("A user can write up to %d chirps an hour", limits.ChirpsPerHour),
+		})
+		return
+	}
+
+	chirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
 		Body: sql.NullString{
 			Valid:  true,
 			String: cleanedBody,
@@ -75,72 +217,165 @@ func createChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 			UUID:  userID,
 			Valid: true,
 		},
+		InReplyTo: inReplyTo,
 	})
-	if err != nil {
+	if isPQError(err, foreignKeyViolation) {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Chirp being replied to does not exist",
+		})
+		return
+	} else if err != nil {
 		log.Printf("Error writing chirp: %v\n", err)
 		jsonResponse(w, http.StatusInternalServerError, errorPayload{
 			Error: "Something went wrong",
 		})
 		return
 	}
+	if err := indexChirpBody(r.Context(), qtx, chirp, mentions); err != nil {
+		log.Printf("Error indexing chirp: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	if len(mediaIDs) > 0 {
+		// Only media the user uploaded and has not attached yet can be
+		// attached.
+		attached, err := qtx.AttachMediaToChirp(r.Context(), database.AttachMediaToChirpParams{
+			ChirpID: uuid.NullUUID{
+				UUID:  chirp.ID,
+				Valid: true,
+			},
+			MediaIds: mediaIDs,
+			UserID:   userID,
+		})
+		if err != nil {
+			log.Printf("Error attaching media: %v\n", err)
+			jsonResponse(w, http.StatusInternalServerError, errorPayload{
+				Error: "Something went wrong",
+			})
+			return
+		}
+		if attached != int64(len(mediaIDs)) {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Media not found",
+			})
+			return
+		}
+	}
+	if err := enqueueOutboxEvent(r.Context(), qtx, outboxChirpCreated, userID, newWebhookChirp(chirp)); err != nil {
+		log.Printf("Error in queueing webhook event: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
 
-	jsonResponse(w, http.StatusCreated, responsePayload{
-		ID:        chirp.ID,
-		UserID:    chirp.UserID.UUID,
-		Body:      chirp.Body.String,
-		CreatedAt: chirp.CreatedAt.Time,
-		UpdatedAt: chirp.UpdatedAt.Time,
-	})
+	response, err := chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, uuid.NullUUID{
+		UUID:  userID,
+		Valid: true,
+	}), []database.Chirp{chirp})
+	if err != nil {
+		log.Printf("Error converting chirp: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusCreated, responsePayload(response[0]))
 }
 
 func listChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
-	type responsePayloadItem chirp
+	type responsePayload chirpsPage
+
+	viewerID := optionalBearerUserID(cfg, r)
 
-	authorIDString := r.URL.Query().Get("author_id")
+	query := r.URL.Query()
 
-	var (
-		chirps []database.Chirp
-		err    error
-	)
-	if len(authorIDString) > 0 {
-		var authorID uuid.UUID
-		authorID, err = uuid.Parse(authorIDString)
+	var authorID uuid.NullUUID
+	if authorIDString := query.Get("author_id"); len(authorIDString) > 0 {
+		id, err := uuid.Parse(authorIDString)
 		if err != nil {
 			log.Printf("GET chirps: error in parsing author ID: %v\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Invalid author_id",
+			})
 			return
 		}
-		chirps, err = cfg.dbQueries.GetUsersChirps(r.Context(), uuid.NullUUID{
-			UUID:  authorID,
+		authorID = uuid.NullUUID{
+			UUID:  id,
 			Valid: true,
-		})
-		fmt.Printf("chirps: %v\n", chirps)
-		fmt.Printf("authorID: %v\n", authorID)
-	} else {
-		chirps, err = cfg.dbQueries.GetAllChirps(r.Context())
+		}
 	}
+
+	limit, err := parsePageLimit(query.Get("limit"))
 	if err != nil {
-		log.Printf("GET chirps: error when retrieving all chirps: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GET chirps: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
 		return
 	}
 
-	sort := r.URL.Query().Get("sort")
-	if sort == "desc" {
-		slices.SortFunc(chirps, func(a, b database.Chirp) int {
-			return int(b.CreatedAt.Time.Sub(a.CreatedAt.Time))
+	cursorCreatedAt, cursorID, err := parsePageCursor(query.Get("cursor"))
+	if err != nil {
+		log.Printf("GET chirps: error in decoding cursor: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid cursor",
 		})
+		return
 	}
 
-	response := make([]responsePayloadItem, 0, len(chirps))
-	for _, chirp := range chirps {
-		response = append(response, responsePayloadItem{
-			ID:        chirp.ID,
-			UserID:    chirp.UserID.UUID,
-			Body:      chirp.Body.String,
-			CreatedAt: chirp.CreatedAt.Time,
-			UpdatedAt: chirp.UpdatedAt.Time,
+	// One extra row is fetched to know whether a next page exists.
+	var chirps []database.Chirp
+	switch sort := query.Get("sort"); sort {
+	case "", ascendingSort:
+		chirps, err = cfg.dbQueries.ListChirpsAscending(r.Context(), database.ListChirpsAscendingParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        limit + 1,
 		})
+	case descendingSort:
+		chirps, err = cfg.dbQueries.ListChirpsDescending(r.Context(), database.ListChirpsDescendingParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        limit + 1,
+		})
+	default:
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: fmt.Sprintf("Invalid sort %q", sort),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("GET chirps: error when retrieving chirps: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		response.NextCursor = pageCursor{
+			CreatedAt: last.CreatedAt.Time,
+			ID:        last.ID,
+		}.encode()
+	}
+	response.Chirps, err = chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, viewerID), chirps)
+	if err != nil {
+		log.Printf("GET chirps: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 	jsonResponse(w, http.StatusOK, response)
 }
@@ -148,6 +383,8 @@ func listChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 func getChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 	type responsePayload chirp
 
+	viewerID := optionalBearerUserID(cfg, r)
+
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
 		log.Printf("Error in finding chirp ID: %v\n", err)
@@ -168,13 +405,13 @@ func getChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonResponse(w, http.StatusOK, responsePayload{
-		ID:        chirp.ID,
-		UserID:    chirp.UserID.UUID,
-		Body:      chirp.Body.String,
-		CreatedAt: chirp.CreatedAt.Time,
-		UpdatedAt: chirp.UpdatedAt.Time,
-	})
+	response, err := chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, viewerID), []database.Chirp{chirp})
+	if err != nil {
+		log.Printf("GET chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, responsePayload(response[0]))
 }
 
 func deleteChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
@@ -184,10 +421,10 @@ func deleteChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsWrite)
 	if err != nil {
-		log.Printf("DELETE chirp: error in validating JWT token: %v\n", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		log.Printf("DELETE chirp: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeChirpsWrite)
 		return
 	}
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
@@ -197,7 +434,16 @@ func deleteChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	chirpsDeleted, err := cfg.dbQueries.DeleteChirp(r.Context(), database.DeleteChirpParams{
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("DELETE chirp: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	chirpsDeleted, err := qtx.DeleteChirp(r.Context(), database.DeleteChirpParams{
 		ID: chirpID,
 		UserID: uuid.NullUUID{
 			UUID:  userID,
@@ -209,6 +455,160 @@ func deleteChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
+	if err := enqueueOutboxEvent(r.Context(), qtx, outboxChirpDeleted, userID, webhookChirp{
+		ID:     chirpID,
+		UserID: userID,
+	}); err != nil {
+		log.Printf("DELETE chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("DELETE chirp: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func updateChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		Body string `json:"body"`
+	}
+
+	type responsePayload chirp
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("PUT chirp: error in getting token from authorization: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Unauthorized",
+		})
+		return
+	}
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsWrite)
+	if err != nil {
+		log.Printf("PUT chirp: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeChirpsWrite)
+		return
+	}
+	limits, err := userLimits(r.Context(), cfg, userID)
+	if err != nil {
+		log.Printf("PUT chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("PUT chirp: error while parsing chirp ID: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid chirp ID",
+		})
+		return
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("PUT chirp: error decoding request body: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+	mentioned, err := resolveMentions(r.Context(), cfg.dbQueries, request.Body)
+	if err != nil {
+		log.Printf("PUT chirp: error in resolving mentions: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	cleanedBody, mentions, err := cleanChirpBody(request.Body, limits.MaxChirpLength, mentioned)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Chirp is too long",
+		})
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("PUT chirp: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// The row is locked so that concurrent edits cannot both record the
+	// same body as the earlier revision.
+	previous, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("PUT chirp: error in retrieving chirp: %v\n", err)
+		jsonResponse(w, http.StatusNotFound, errorPayload{
+			Error: "Chirp not found",
+		})
+		return
+	}
+	if previous.UserID.UUID != userID {
+		jsonResponse(w, http.StatusForbidden, errorPayload{
+			Error: "Forbidden",
+		})
+		return
+	}
+	if time.Since(previous.CreatedAt.Time) > limits.EditWindow {
+		jsonResponse(w, http.StatusForbidden, errorPayload{
+			Error: "Chirp can no longer be edited",
+		})
+		return
+	}
+
+	updated := previous
+	if previous.Body.String != cleanedBody {
+		if _, err := qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+			ChirpID: previous.ID,
+			Body:    previous.Body.String,
+		}); err != nil {
+			log.Printf("PUT chirp: error in storing revision: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		updated, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+			ID: previous.ID,
+			Body: sql.NullString{
+				Valid:  true,
+				String: cleanedBody,
+			},
+		})
+		if err != nil {
+			log.Printf("PUT chirp: error in updating chirp: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := unindexChirpBody(r.Context(), qtx, updated.ID); err != nil {
+			log.Printf("PUT chirp: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := indexChirpBody(r.Context(), qtx, updated, mentions); err != nil {
+			log.Printf("PUT chirp: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("PUT chirp: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, uuid.NullUUID{
+		UUID:  userID,
+		Valid: true,
+	}), []database.Chirp{updated})
+	if err != nil {
+		log.Printf("PUT chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, responsePayload(response[0]))
+}
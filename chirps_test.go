@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCleanChirpBody(t *testing.T) {
+	mentioned := map[string]uuid.UUID{
+		"valen": uuid.New(),
+	}
+
+	tests := []struct {
+		name string // description of this test case
+		// Named input parameters for target function.
+		body         string
+		maxLength    int
+		want         string
+		wantMentions []string
+		wantErr      bool
+	}{
+		{
+			name:      "profane words are masked",
+			body:      "What a Kerfuffle that was",
+			maxLength: 140,
+			want:      "What a **** that was",
+			wantErr:   false,
+		},
+		{
+			name:         "mention of an existing user is kept",
+			body:         "Hey @Valen, kerfuffle",
+			maxLength:    140,
+			want:         "Hey @Valen, ****",
+			wantMentions: []string{"@Valen"},
+			wantErr:      false,
+		},
+		{
+			name:      "unresolved mention is masked",
+			body:      "Hey @kerfuffle and @sharbert_",
+			maxLength: 140,
+			want:      "Hey @**** and @****_",
+			wantErr:   false,
+		},
+		{
+			name:      "masking does not make a mention",
+			body:      "Hey @valenkerfuffle",
+			maxLength: 140,
+			want:      "Hey @valen****",
+			wantErr:   false,
+		},
+		{
+			name:         "mention offsets are in the cleaned body",
+			body:         "fornax fornax @valen",
+			maxLength:    140,
+			want:         "**** **** @valen",
+			wantMentions: []string{"@valen"},
+			wantErr:      false,
+		},
+		{
+			name:      "email address is masked",
+			body:      "Mail me at fornax@example.com",
+			maxLength: 140,
+			want:      "Mail me at ****@example.com",
+			wantErr:   false,
+		},
+		{
+			name:      "body is too long",
+			body:      "ééé",
+			maxLength: 2,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotMentions, gotErr := cleanChirpBody(tt.body, tt.maxLength, mentioned)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("cleanChirpBody() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("cleanChirpBody() succeeded unexpectedly")
+			}
+			if got != tt.want {
+				t.Errorf("cleanChirpBody() = %q, want %q", got, tt.want)
+			}
+			if len(gotMentions) != len(tt.wantMentions) {
+				t.Fatalf("cleanChirpBody() mentions = %+v, want %q", gotMentions, tt.wantMentions)
+			}
+			for i, span := range gotMentions {
+				if mention := got[span.Start:span.End]; mention != tt.wantMentions[i] || span.UserID != mentioned["valen"] {
+					t.Errorf("cleanChirpBody() mention %d = %q of %v, want %q", i, mention, span.UserID, tt.wantMentions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateHandle(t *testing.T) {
+	tests := []struct {
+		handle  string
+		wantErr bool
+	}{
+		{handle: "valen_42", wantErr: false},
+		{handle: "ab", wantErr: true},
+		{handle: "Admin", wantErr: true},
+		{handle: "kerfuffle", wantErr: true},
+		{handle: "xSharbertx", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.handle, func(t *testing.T) {
+			if err := validateHandle(tt.handle); (err != nil) != tt.wantErr {
+				t.Errorf("validateHandle(%q) error = %v, wantErr %v", tt.handle, err, tt.wantErr)
+			}
+		})
+	}
+}
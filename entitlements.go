@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// chirpRateWindow is the window chirpLimits.ChirpsPerHour is counted over.
+const chirpRateWindow = time.Hour
+
+// chirpLimits are what a user may do with their chirps. Chirpy Red
+// members get their own, see limitsFor.
+type chirpLimits struct {
+	// MaxChirpLength is the most runes a chirp's body may have.
+	MaxChirpLength int
+	// MaxChirpMedia is how many media can be attached to one chirp.
+	MaxChirpMedia int
+	// EditWindow is how long after it is written a chirp can be edited.
+	EditWindow time.Duration
+	// ChirpsPerHour is how many chirps may be written within an hour.
+	ChirpsPerHour int
+}
+
+var (
+	defaultFreeLimits = chirpLimits{
+		MaxChirpLength: 140,
+		MaxChirpMedia:  4,
+		EditWindow:     15 * time.Minute,
+		ChirpsPerHour:  50,
+	}
+	defaultRedLimits = chirpLimits{
+		MaxChirpLength: 1000,
+		MaxChirpMedia:  10,
+		EditWindow:     24 * time.Hour,
+		ChirpsPerHour:  500,
+	}
+)
+
+// loadChirpLimits overrides defaults with the environment variables that
+// are set among MAX_CHIRP_LENGTH, MAX_CHIRP_MEDIA, CHIRP_EDIT_WINDOW and
+// CHIRPS_PER_HOUR, each preceded by prefix.
+func loadChirpLimits(prefix string, defaults chirpLimits) (chirpLimits, error) {
+	limits := defaults
+	for name, limit := range map[string]*int{
+		prefix + "MAX_CHIRP_LENGTH": &limits.MaxChirpLength,
+		prefix + "MAX_CHIRP_MEDIA":  &limits.MaxChirpMedia,
+		prefix + "CHIRPS_PER_HOUR":  &limits.ChirpsPerHour,
+	} {
+		if s := os.Getenv(name); len(s) > 0 {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return chirpLimits{}, fmt.Errorf("%v is not a positive integer: %v", name, s)
+			}
+			*limit = n
+		}
+	}
+	name := prefix + "CHIRP_EDIT_WINDOW"
+	if s := os.Getenv(name); len(s) > 0 {
+		window, err := time.ParseDuration(s)
+		if err != nil || window < 0 {
+			return chirpLimits{}, fmt.Errorf("%v is not a duration: %v", name, s)
+		}
+		limits.EditWindow = window
+	}
+	return limits, nil
+}
+
+// limitsFor returns the limits of a user depending on whether they are
+// Chirpy Red.
+func (cfg *apiConfig) limitsFor(isChirpyRed bool) chirpLimits {
+	if isChirpyRed {
+		return cfg.redLimits
+	}
+	return cfg.freeLimits
+}
+
+// userLimits returns the limits of user userID.
+func userLimits(ctx context.Context, cfg *apiConfig, userID uuid.UUID) (chirpLimits, error) {
+	isChirpyRed, err := cfg.dbQueries.IsUserChirpyRed(ctx, userID)
+	if err != nil {
+		return chirpLimits{}, fmt.Errorf("error in getting subscription: %w", err)
+	}
+	return cfg.limitsFor(isChirpyRed), nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func followUserHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST follow: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	followerID, err := authenticate(r.Context(), cfg, token, scopeFollowsWrite)
+	if err != nil {
+		log.Printf("POST follow: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeFollowsWrite)
+		return
+	}
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("POST follow: error while parsing user ID: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if followerID == followeeID {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Users cannot follow themselves",
+		})
+		return
+	}
+
+	// Following a user twice is not an error, the second follow is a no-op.
+	_, err = cfg.dbQueries.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if isPQError(err, foreignKeyViolation) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("POST follow: error in following user: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func unfollowUserHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("DELETE follow: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	followerID, err := authenticate(r.Context(), cfg, token, scopeFollowsWrite)
+	if err != nil {
+		log.Printf("DELETE follow: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeFollowsWrite)
+		return
+	}
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("DELETE follow: error while parsing user ID: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if _, err := cfg.dbQueries.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	}); err != nil {
+		log.Printf("DELETE follow: error in unfollowing user: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listFollowersHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	listFollows(w, r, "GET followers", func(ctx context.Context, arg database.GetFollowersParams) ([]follow, error) {
+		follows, err := cfg.dbQueries.GetFollowers(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		response := make([]follow, 0, len(follows))
+		for _, f := range follows {
+			response = append(response, follow{
+				UserID:    f.FollowerID,
+				CreatedAt: f.CreatedAt,
+			})
+		}
+		return response, nil
+	})
+}
+
+func listFollowingHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	listFollows(w, r, "GET following", func(ctx context.Context, arg database.GetFollowersParams) ([]follow, error) {
+		follows, err := cfg.dbQueries.GetFollowing(ctx, database.GetFollowingParams(arg))
+		if err != nil {
+			return nil, err
+		}
+		response := make([]follow, 0, len(follows))
+		for _, f := range follows {
+			response = append(response, follow{
+				UserID:    f.FolloweeID,
+				CreatedAt: f.CreatedAt,
+			})
+		}
+		return response, nil
+	})
+}
+
+// listFollows writes one page of the follows of the user in the request's
+// path. Followers and following only differ in the side of the follow
+// being listed, which is left to getFollows.
+func listFollows(
+	w http.ResponseWriter,
+	r *http.Request,
+	logPrefix string,
+	getFollows func(ctx context.Context, arg database.GetFollowersParams) ([]follow, error),
+) {
+	type responsePayload followsPage
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("%v: error while parsing user ID: %v\n", logPrefix, err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("%v: %v\n", logPrefix, err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	cursorCreatedAt, cursorID, err := parsePageCursor(query.Get("cursor"))
+	if err != nil {
+		log.Printf("%v: error in decoding cursor: %v\n", logPrefix, err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid cursor",
+		})
+		return
+	}
+
+	// One extra row is fetched to know whether a next page exists.
+	follows, err := getFollows(r.Context(), database.GetFollowersParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        limit + 1,
+	})
+	if err != nil {
+		log.Printf("%v: error in retrieving follows: %v\n", logPrefix, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(follows) > int(limit) {
+		follows = follows[:limit]
+		last := follows[len(follows)-1]
+		response.NextCursor = pageCursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.UserID,
+		}.encode()
+	}
+	response.Follows = follows
+	jsonResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+)
+
+// hashtagPattern matches a `#` followed by a tag, when the `#` does not
+// continue a word, as in `issue#12`.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])#([\p{L}\p{N}_]{1,50})`)
+
+// extractHashtags returns the distinct tags of body, lowercased, in the
+// order they first appear.
+func extractHashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// indexChirpHashtags stores the hashtags of a chirp's body.
+func indexChirpHashtags(ctx context.Context, q *database.Queries, c database.Chirp) error {
+	tags := extractHashtags(c.Body.String)
+	if len(tags) == 0 {
+		return nil
+	}
+	return q.AddChirpHashtags(ctx, database.AddChirpHashtagsParams{
+		ChirpID:   c.ID,
+		Tags:      tags,
+		CreatedAt: c.CreatedAt.Time,
+	})
+}
+
+func listHashtagChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload chirpsPage
+
+	viewerID := optionalBearerUserID(cfg, r)
+
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET hashtag chirps: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	cursorCreatedAt, cursorID, err := parsePageCursor(query.Get("cursor"))
+	if err != nil {
+		log.Printf("GET hashtag chirps: error in decoding cursor: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid cursor",
+		})
+		return
+	}
+
+	// One extra row is fetched to know whether a next page exists.
+	chirps, err := cfg.dbQueries.GetHashtagChirps(r.Context(), database.GetHashtagChirpsParams{
+		Tag:             tag,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        limit + 1,
+	})
+	if err != nil {
+		log.Printf("GET hashtag chirps: error in retrieving chirps: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		response.NextCursor = pageCursor{
+			CreatedAt: last.CreatedAt.Time,
+			ID:        last.ID,
+		}.encode()
+	}
+	response.Chirps, err = chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, viewerID), chirps)
+	if err != nil {
+		log.Printf("GET hashtag chirps: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+func trendingHashtagsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayloadItem trendingHashtag
+
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET trending hashtags: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	window := cfg.trendingWindow
+	if windowString := query.Get("window"); len(windowString) > 0 {
+		window, err = time.ParseDuration(windowString)
+		if err != nil || window <= 0 || window > maxTrendingWindow {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Invalid window",
+			})
+			return
+		}
+	}
+
+	// A use of a tag counts for half as much every quarter of the window,
+	// so that a tag used a lot just now outranks one used a lot a while
+	// ago.
+	halfLife := window / 4
+	tags, err := cfg.dbQueries.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+		DecaySeconds:  halfLife.Seconds() / math.Ln2,
+		WindowSeconds: window.Seconds(),
+		RowLimit:      limit,
+	})
+	if err != nil {
+		log.Printf("GET trending hashtags: error in retrieving hashtags: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]responsePayloadItem, 0, len(tags))
+	for _, tag := range tags {
+		response = append(response, responsePayloadItem{
+			Tag:   tag.Tag,
+			Uses:  tag.Uses,
+			Score: tag.Score,
+		})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// accessTokenPrefix tells personal access tokens apart from JWTs, and makes
+// them easy to spot by secret scanners.
+const accessTokenPrefix = "chirpy_pat_"
+
+// MakeAccessToken returns a new personal access token. Only its hash, see
+// HashAccessToken, is to be stored.
+func MakeAccessToken() (string, error) {
+	randBytes := make([]byte, 32)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", fmt.Errorf("MakeAccessToken: %v", err)
+	}
+	return accessTokenPrefix + hex.EncodeToString(randBytes), nil
+}
+
+// IsAccessToken reports whether token is a personal access token rather
+// than a JWT.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, accessTokenPrefix)
+}
+
+// HashAccessToken returns the form personal access tokens are stored and
+// looked up in. They are random enough that a fast hash does.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
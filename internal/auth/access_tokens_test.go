@@ -0,0 +1,99 @@
+package auth_test
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMakeAccessToken(t *testing.T) {
+	token, err := auth.MakeAccessToken()
+	if err != nil {
+		t.Fatalf("MakeAccessToken() error = %v", err)
+	}
+	if !strings.HasPrefix(token, "chirpy_pat_") {
+		t.Errorf("MakeAccessToken() = %q, want prefix %q", token, "chirpy_pat_")
+	}
+	if !auth.IsAccessToken(token) {
+		t.Errorf("IsAccessToken(%q) = false, want true", token)
+	}
+	other, err := auth.MakeAccessToken()
+	if err != nil {
+		t.Fatalf("MakeAccessToken() error = %v", err)
+	}
+	if token == other {
+		t.Errorf("MakeAccessToken() returned %q twice", token)
+	}
+}
+
+func TestHashAccessToken(t *testing.T) {
+	token, err := auth.MakeAccessToken()
+	if err != nil {
+		t.Fatalf("MakeAccessToken() error = %v", err)
+	}
+	other, err := auth.MakeAccessToken()
+	if err != nil {
+		t.Fatalf("MakeAccessToken() error = %v", err)
+	}
+
+	hash := auth.HashAccessToken(token)
+	if got := auth.HashAccessToken(token); got != hash {
+		t.Errorf("HashAccessToken() = %q, then %q for the same token", hash, got)
+	}
+	if got := auth.HashAccessToken(other); got == hash {
+		t.Errorf("HashAccessToken() = %q for two tokens", got)
+	}
+	if strings.Contains(hash, token) {
+		t.Errorf("HashAccessToken() = %q contains the token", hash)
+	}
+}
+
+func TestIsAccessToken(t *testing.T) {
+	keys := newKeyRing(t, "kid", "kid")
+	jwt, err := auth.MakeJWT(uuid.New(), keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string // description of this test case
+		token string
+		want  bool
+	}{
+		{
+			name:  "personal access token",
+			token: "chirpy_pat_0123456789abcdef",
+			want:  true,
+		},
+		{
+			name:  "JWT",
+			token: jwt,
+			want:  false,
+		},
+		{
+			name:  "legacy JWT",
+			token: makeLegacyJWT(t, uuid.New(), defaultHmacKey),
+			want:  false,
+		},
+		{
+			name:  "prefix not at the start",
+			token: "Bearer chirpy_pat_0123456789abcdef",
+			want:  false,
+		},
+		{
+			name:  "empty token",
+			token: "",
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auth.IsAccessToken(tt.token); got != tt.want {
+				t.Errorf("IsAccessToken(%q) = %v, want %v", tt.token, got, tt.want)
+			}
+		})
+	}
+}
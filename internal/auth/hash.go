@@ -1,11 +1,55 @@
 package auth
 
-import "github.com/alexedwards/argon2id"
+import (
+	"fmt"
 
-func HashPassword(password string) (string, error) {
-	return argon2id.CreateHash(password, argon2id.DefaultParams)
+	"github.com/alexedwards/argon2id"
+)
+
+// PasswordParams are the argon2id parameters passwords are hashed with.
+// Memory is in KiB.
+type PasswordParams = argon2id.Params
+
+// DefaultPasswordParams are the parameters of the argon2id package, which
+// every password was hashed with before they could be configured.
+var DefaultPasswordParams = argon2id.DefaultParams
+
+func HashPassword(password string, params *PasswordParams) (string, error) {
+	return argon2id.CreateHash(password, params)
 }
 
 func CheckPasswordHash(password, hash string) (bool, error) {
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
+
+// NeedsRehash reports whether hash was made with weaker parameters than
+// params, so that it should be replaced with a hash made with params the
+// next time the password is known.
+func NeedsRehash(hash string, params *PasswordParams) (bool, error) {
+	hashParams, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+	return IsWeakerPasswordParams(hashParams, params), nil
+}
+
+// IsWeakerPasswordParams reports whether p costs less to guess against
+// than target. Parallelism is left out, as it changes how long a hash
+// takes, not how much work it is.
+func IsWeakerPasswordParams(p, target *PasswordParams) bool {
+	return p.Memory < target.Memory ||
+		p.Iterations < target.Iterations ||
+		p.SaltLength < target.SaltLength ||
+		p.KeyLength < target.KeyLength
+}
+
+// ParsePasswordParams parses the parameters section of a hash, such as
+// "m=65536,t=1,p=2". Salt and key lengths are not part of it and are left
+// zero.
+func ParsePasswordParams(s string) (*PasswordParams, error) {
+	p := &PasswordParams{}
+	if _, err := fmt.Sscanf(s, "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return nil, fmt.Errorf("ParsePasswordParams: %q: %v", s, err)
+	}
+	return p, nil
+}
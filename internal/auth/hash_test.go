@@ -0,0 +1,114 @@
+package auth_test
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"testing"
+)
+
+func TestNeedsRehash(t *testing.T) {
+	// Memory is kept small, so that hashing is quick.
+	weak := &auth.PasswordParams{
+		Memory:      8 * 1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	hash, err := auth.HashPassword("correct horse", weak)
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string // description of this test case
+		hash    string
+		params  auth.PasswordParams
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "same parameters",
+			hash:   hash,
+			params: *weak,
+			want:   false,
+		},
+		{
+			name: "more memory",
+			hash: hash,
+			params: auth.PasswordParams{
+				Memory:      16 * 1024,
+				Iterations:  1,
+				Parallelism: 1,
+				SaltLength:  16,
+				KeyLength:   32,
+			},
+			want: true,
+		},
+		{
+			name: "more iterations",
+			hash: hash,
+			params: auth.PasswordParams{
+				Memory:      8 * 1024,
+				Iterations:  2,
+				Parallelism: 1,
+				SaltLength:  16,
+				KeyLength:   32,
+			},
+			want: true,
+		},
+		{
+			name: "more parallelism only",
+			hash: hash,
+			params: auth.PasswordParams{
+				Memory:      8 * 1024,
+				Iterations:  1,
+				Parallelism: 4,
+				SaltLength:  16,
+				KeyLength:   32,
+			},
+			want: false,
+		},
+		{
+			name: "less memory",
+			hash: hash,
+			params: auth.PasswordParams{
+				Memory:      4 * 1024,
+				Iterations:  1,
+				Parallelism: 1,
+				SaltLength:  16,
+				KeyLength:   32,
+			},
+			want: false,
+		},
+		{
+			name:    "not a hash",
+			hash:    "unset",
+			params:  *weak,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.NeedsRehash(tt.hash, &tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NeedsRehash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePasswordParams(t *testing.T) {
+	got, err := auth.ParsePasswordParams("m=65536,t=3,p=2")
+	if err != nil {
+		t.Fatalf("ParsePasswordParams() error = %v", err)
+	}
+	if got.Memory != 65536 || got.Iterations != 3 || got.Parallelism != 2 {
+		t.Errorf("ParsePasswordParams() = %+v", got)
+	}
+	if _, err := auth.ParsePasswordParams("v=19"); err == nil {
+		t.Errorf("ParsePasswordParams() error = nil, want an error")
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -10,44 +11,224 @@ import (
 	"github.com/google/uuid"
 )
 
-var signingMethod = jwt.SigningMethodHS256
+var (
+	signingMethod       = jwt.SigningMethodEdDSA
+	legacySigningMethod = jwt.SigningMethodHS256
+)
+
+// challengeAudience is the audience of challenge tokens. Access tokens
+// have no audience, which is what keeps the two apart.
+const challengeAudience = "chirpy:login-challenge"
+
+// challengeExpiresIn is how long the second step of a login may take.
+const challengeExpiresIn = 5 * time.Minute
+
+// claims are the claims of every token. Scope and ClientID are only set on
+// access tokens issued to OAuth clients.
+type claims struct {
+	jwt.RegisteredClaims
+	// Scope is a space separated list (RFC 8693, section 4.2).
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
 
 func MakeJWT(
 	userID uuid.UUID,
-	tokenSecret string,
+	keys *KeyRing,
+	expiresIn time.Duration,
+) (string, error) {
+	return makeJWT(keys, newClaims(userID, expiresIn))
+}
+
+// ValidateJWT validates an access token from a login. Tokens issued to
+// OAuth clients are rejected, see ValidateAccessJWT.
+func ValidateJWT(tokenString string, keys *KeyRing) (uuid.UUID, error) {
+	c, err := validateJWT(tokenString, keys, "")
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if len(c.ClientID) > 0 {
+		return uuid.Nil, fmt.Errorf("token is issued to client %v", c.ClientID)
+	}
+	return uuid.Parse(c.Subject)
+}
+
+// AccessClaims are what an access token grants.
+type AccessClaims struct {
+	UserID uuid.UUID
+	// ClientID and Scopes are only set on tokens issued to OAuth clients.
+	// Other tokens are granted every scope.
+	ClientID  string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// MakeClientJWT returns an access token issued to the OAuth client
+// clientID, granted scopes only.
+func MakeClientJWT(
+	userID uuid.UUID,
+	keys *KeyRing,
 	expiresIn time.Duration,
+	clientID string,
+	scopes []string,
 ) (string, error) {
+	c := newClaims(userID, expiresIn)
+	c.ClientID = clientID
+	c.Scope = strings.Join(scopes, " ")
+	return makeJWT(keys, c)
+}
+
+// ValidateAccessJWT validates an access token, whether from a login or
+// issued to an OAuth client.
+func ValidateAccessJWT(tokenString string, keys *KeyRing) (AccessClaims, error) {
+	c, err := validateJWT(tokenString, keys, "")
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	userID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	access := AccessClaims{
+		UserID:   userID,
+		ClientID: c.ClientID,
+	}
+	if len(c.ClientID) > 0 {
+		access.Scopes = strings.Fields(c.Scope)
+	}
+	if c.IssuedAt != nil {
+		access.IssuedAt = c.IssuedAt.Time
+	}
+	if c.ExpiresAt != nil {
+		access.ExpiresAt = c.ExpiresAt.Time
+	}
+	return access, nil
+}
+
+// MakeChallengeJWT returns a token that proves the user has passed the
+// first step of a login, i.e. their password, and nothing else.
+func MakeChallengeJWT(userID uuid.UUID, keys *KeyRing) (string, error) {
+	c := newClaims(userID, challengeExpiresIn)
+	c.Audience = jwt.ClaimStrings{challengeAudience}
+	return makeJWT(keys, c)
+}
+
+func ValidateChallengeJWT(tokenString string, keys *KeyRing) (uuid.UUID, error) {
+	c, err := validateJWT(tokenString, keys, challengeAudience)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(c.Subject)
+}
+
+// TokenPurpose is what a one-time token may be used for. It is the
+// token's audience.
+type TokenPurpose string
+
+const (
+	PurposeVerifyEmail   TokenPurpose = "chirpy:verify-email"
+	PurposeResetPassword TokenPurpose = "chirpy:reset-password"
+)
+
+// MakeOneTimeJWT returns a token for purpose along with its ID. It is up
+// to the caller to remember the ID and forget it once the token is used.
+func MakeOneTimeJWT(
+	userID uuid.UUID,
+	keys *KeyRing,
+	purpose TokenPurpose,
+	expiresIn time.Duration,
+) (string, uuid.UUID, error) {
+	tokenID := uuid.New()
+	c := newClaims(userID, expiresIn)
+	c.Audience = jwt.ClaimStrings{string(purpose)}
+	c.ID = tokenID.String()
+	tokenString, err := makeJWT(keys, c)
+	return tokenString, tokenID, err
+}
+
+// ValidateOneTimeJWT validates a token for purpose and returns its user
+// and token IDs.
+func ValidateOneTimeJWT(
+	tokenString string,
+	keys *KeyRing,
+	purpose TokenPurpose,
+) (uuid.UUID, uuid.UUID, error) {
+	c, err := validateJWT(tokenString, keys, string(purpose))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	userID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	tokenID, err := uuid.Parse(c.ID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	return userID, tokenID, nil
+}
+
+func newClaims(userID uuid.UUID, expiresIn time.Duration) claims {
 	now := time.Now().UTC()
-	token := jwt.NewWithClaims(signingMethod, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
-		Subject:   userID.String(),
-	})
-	return token.SignedString([]byte(tokenSecret))
+	return claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	}
+}
+
+func makeJWT(keys *KeyRing, c claims) (string, error) {
+	c.Issuer = keys.issuer
+	token := jwt.NewWithClaims(signingMethod, c)
+	token.Header["kid"] = keys.signingKID
+	return token.SignedString(keys.keys[keys.signingKID])
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// validateJWT validates a token meant for audience. An empty audience
+// stands for access tokens, which must not have one.
+func validateJWT(tokenString string, keys *KeyRing, audience string) (*claims, error) {
+	validMethods := []string{signingMethod.Alg()}
+	if keys.acceptsLegacy() {
+		validMethods = append(validMethods, legacySigningMethod.Alg())
+	}
+	options := []jwt.ParserOption{jwt.WithValidMethods(validMethods)}
+	if len(audience) > 0 {
+		options = append(options, jwt.WithAudience(audience))
+	}
+	c := &claims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
-		&jwt.RegisteredClaims{},
+		c,
 		func(t *jwt.Token) (any, error) {
-			return []byte(tokenSecret), nil
+			// The key is picked by the algorithm first, so that a
+			// token cannot have its signature checked with a key
+			// meant for another algorithm.
+			if t.Method.Alg() == legacySigningMethod.Alg() {
+				return keys.legacySecret, nil
+			}
+			kid, _ := t.Header["kid"].(string)
+			key, ok := keys.keys[kid]
+			if !ok {
+				return nil, fmt.Errorf("unknown key ID %q", kid)
+			}
+			return key.Public(), nil
 		},
-		jwt.WithValidMethods([]string{signingMethod.Alg()}),
+		options...,
 	)
 	if err != nil {
-		return uuid.Nil, err
-	}
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
-	userID, err := uuid.Parse(userIDString)
-	if err != nil {
-		return uuid.Nil, err
+	if len(audience) == 0 {
+		if tokenAudience, err := token.Claims.GetAudience(); err != nil {
+			return nil, err
+		} else if len(tokenAudience) > 0 {
+			return nil, fmt.Errorf("token is meant for %v", tokenAudience)
+		}
 	}
-	return userID, nil
+	return c, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -2,81 +2,161 @@ package auth_test
 
 import (
 	"ValenTheRed/chirpy/internal/auth"
+	"crypto/ed25519"
+	"crypto/rand"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 const defaultHmacKey = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
 
+func newKeyRing(t *testing.T, signingKID string, kids ...string) *auth.KeyRing {
+	t.Helper()
+	keys := make(map[string]ed25519.PrivateKey, len(kids))
+	for _, kid := range kids {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[kid] = key
+	}
+	keyRing, err := auth.NewKeyRing(keys, signingKID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyRing
+}
+
+func makeLegacyJWT(t *testing.T, userID uuid.UUID, secret string) string {
+	t.Helper()
+	now := time.Now().UTC()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		Subject:   userID.String(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
 func TestValidateJWT(t *testing.T) {
 	uuids := uuid.UUIDs{
 		uuid.New(),
 		uuid.New(),
+		uuid.New(),
 	}
+	keys := newKeyRing(t, "old", "old", "new")
+	rotatedKeys := newKeyRing(t, "new", "new")
+	otherKeys := newKeyRing(t, "old", "old", "new")
+	keys.AcceptLegacySecret(defaultHmacKey, time.Now().Add(time.Hour))
+	lapsedKeys := newKeyRing(t, "old", "old")
+	lapsedKeys.AcceptLegacySecret(defaultHmacKey, time.Now().Add(-time.Hour))
+
 	makeJWTArgs := []struct {
-		userID      uuid.UUID
-		tokenSecret string
-		expiresIn   time.Duration
+		userID    uuid.UUID
+		keys      *auth.KeyRing
+		expiresIn time.Duration
 	}{
 		{
-			userID:      uuids[0],
-			tokenSecret: defaultHmacKey,
-			expiresIn:   time.Hour,
+			userID:    uuids[0],
+			keys:      keys,
+			expiresIn: time.Hour,
 		},
 		{
-			userID:      uuids[1],
-			tokenSecret: defaultHmacKey,
-			expiresIn:   -time.Hour,
+			userID:    uuids[1],
+			keys:      keys,
+			expiresIn: -time.Hour,
 		},
 	}
 	tokens := make([]string, len(makeJWTArgs))
 	for i, args := range makeJWTArgs {
-		token, _ := auth.MakeJWT(args.userID, args.tokenSecret, args.expiresIn)
+		token, _ := auth.MakeJWT(args.userID, args.keys, args.expiresIn)
 		tokens[i] = token
 	}
+	legacyToken := makeLegacyJWT(t, uuids[2], defaultHmacKey)
+	challengeToken, _ := auth.MakeChallengeJWT(uuids[0], keys)
 
 	tests := []struct {
 		name string // description of this test case
 		// Named input parameters for target function.
 		tokenString string
-		tokenSecret string
+		keys        *auth.KeyRing
 		want        uuid.UUID
 		wantErr     bool
 	}{
 		{
 			name:        "token is valid",
 			tokenString: tokens[0],
-			tokenSecret: defaultHmacKey,
+			keys:        keys,
 			want:        uuids[0],
 			wantErr:     false,
 		},
 		{
 			name:        "token is invalid",
 			tokenString: "",
-			tokenSecret: defaultHmacKey,
+			keys:        keys,
 			want:        uuids[0],
 			wantErr:     true,
 		},
 		{
 			name:        "token is expired",
 			tokenString: tokens[1],
-			tokenSecret: defaultHmacKey,
+			keys:        keys,
 			want:        uuids[1],
 			wantErr:     true,
 		},
 		{
-			name:        "token secret is invalid ",
-			tokenString: tokens[1],
-			tokenSecret: "",
-			want:        uuids[1],
+			name:        "token key is not in the key ring",
+			tokenString: tokens[0],
+			keys:        rotatedKeys,
+			want:        uuids[0],
+			wantErr:     true,
+		},
+		{
+			name:        "token key ID belongs to another key",
+			tokenString: tokens[0],
+			keys:        otherKeys,
+			want:        uuids[0],
+			wantErr:     true,
+		},
+		{
+			name:        "legacy token is accepted",
+			tokenString: legacyToken,
+			keys:        keys,
+			want:        uuids[2],
+			wantErr:     false,
+		},
+		{
+			name:        "legacy token is rejected without legacy secret",
+			tokenString: legacyToken,
+			keys:        rotatedKeys,
+			want:        uuids[2],
+			wantErr:     true,
+		},
+		{
+			name:        "legacy token is rejected once legacy secret lapses",
+			tokenString: legacyToken,
+			keys:        lapsedKeys,
+			want:        uuids[2],
+			wantErr:     true,
+		},
+		{
+			name:        "challenge token is not an access token",
+			tokenString: challengeToken,
+			keys:        keys,
+			want:        uuids[0],
 			wantErr:     true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, gotErr := auth.ValidateJWT(tt.tokenString, tt.tokenSecret)
+			got, gotErr := auth.ValidateJWT(tt.tokenString, tt.keys)
 			if gotErr != nil {
 				if !tt.wantErr {
 					t.Errorf("ValidateJWT() failed: %v", gotErr)
@@ -92,3 +172,111 @@ func TestValidateJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyRingJWKS(t *testing.T) {
+	keys := newKeyRing(t, "b", "b", "a")
+	got := keys.JWKS()
+	if len(got.Keys) != 2 {
+		t.Fatalf("JWKS() has %d keys, want 2", len(got.Keys))
+	}
+	for i, kid := range []string{"a", "b"} {
+		key := got.Keys[i]
+		if key.KeyID != kid || key.KeyType != "OKP" || key.Curve != "Ed25519" || key.Algorithm != "EdDSA" {
+			t.Errorf("JWKS().Keys[%d] = %+v, want Ed25519 key %q", i, key, kid)
+		}
+	}
+}
+
+func TestMakeJWTIssuer(t *testing.T) {
+	keys := newKeyRing(t, "kid", "kid")
+	keys.SetIssuer("https://chirpy.example")
+	token, err := auth.MakeJWT(uuid.New(), keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := parsed.Claims.GetIssuer(); got != keys.Issuer() {
+		t.Errorf("MakeJWT() issuer = %q, want %q", got, keys.Issuer())
+	}
+}
+
+func TestValidateChallengeJWT(t *testing.T) {
+	userID := uuid.New()
+	keys := newKeyRing(t, "kid", "kid")
+	challengeToken, err := auth.MakeChallengeJWT(userID, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := auth.ValidateChallengeJWT(challengeToken, keys); err != nil {
+		t.Errorf("ValidateChallengeJWT() failed: %v", err)
+	} else if got != userID {
+		t.Errorf("ValidateChallengeJWT() = %v, want %v", got, userID)
+	}
+
+	accessToken, err := auth.MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ValidateChallengeJWT(accessToken, keys); err == nil {
+		t.Error("ValidateChallengeJWT() of access token succeeded unexpectedly")
+	}
+}
+
+func TestValidateOneTimeJWT(t *testing.T) {
+	userID := uuid.New()
+	keys := newKeyRing(t, "kid", "kid")
+	token, tokenID, err := auth.MakeOneTimeJWT(userID, keys, auth.PurposeResetPassword, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotUserID, gotTokenID, err := auth.ValidateOneTimeJWT(token, keys, auth.PurposeResetPassword)
+	if err != nil {
+		t.Fatalf("ValidateOneTimeJWT() failed: %v", err)
+	}
+	if gotUserID != userID || gotTokenID != tokenID {
+		t.Errorf("ValidateOneTimeJWT() = %v, %v, want %v, %v", gotUserID, gotTokenID, userID, tokenID)
+	}
+
+	if _, _, err := auth.ValidateOneTimeJWT(token, keys, auth.PurposeVerifyEmail); err == nil {
+		t.Error("ValidateOneTimeJWT() for another purpose succeeded unexpectedly")
+	}
+	if _, err := auth.ValidateJWT(token, keys); err == nil {
+		t.Error("ValidateJWT() of one-time token succeeded unexpectedly")
+	}
+}
+
+func TestValidateAccessJWT(t *testing.T) {
+	userID := uuid.New()
+	keys := newKeyRing(t, "kid", "kid")
+	clientToken, err := auth.MakeClientJWT(userID, keys, time.Hour, "client", []string{"chirps:read", "chirps:write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := auth.ValidateAccessJWT(clientToken, keys)
+	if err != nil {
+		t.Fatalf("ValidateAccessJWT() failed: %v", err)
+	}
+	if got.UserID != userID || got.ClientID != "client" || len(got.Scopes) != 2 {
+		t.Errorf("ValidateAccessJWT() = %+v, want user %v, client %q and 2 scopes", got, userID, "client")
+	}
+	if _, err := auth.ValidateJWT(clientToken, keys); err == nil {
+		t.Error("ValidateJWT() of client token succeeded unexpectedly")
+	}
+
+	loginToken, err := auth.MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = auth.ValidateAccessJWT(loginToken, keys)
+	if err != nil {
+		t.Fatalf("ValidateAccessJWT() failed: %v", err)
+	}
+	if len(got.ClientID) > 0 || got.Scopes != nil {
+		t.Errorf("ValidateAccessJWT() = %+v, want no client and no scopes", got)
+	}
+}
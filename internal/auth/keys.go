@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KeyRing holds the Ed25519 keys JWTs are signed and verified with. Each
+// key is known by its key ID (kid), which is written in the header of the
+// tokens it signs. Only one key signs, but every key in the ring verifies,
+// so a key can be added ahead of signing with it and kept around after,
+// until the tokens it signed have expired.
+type KeyRing struct {
+	signingKID string
+	keys       map[string]ed25519.PrivateKey
+	// legacySecret verifies HS256 tokens signed before the key ring,
+	// until legacyUntil. It is nil when they are not accepted.
+	legacySecret []byte
+	legacyUntil  time.Time
+	// issuer is the iss claim of the tokens signed.
+	issuer string
+}
+
+// NewKeyRing returns a key ring that signs with the key signingKID.
+func NewKeyRing(keys map[string]ed25519.PrivateKey, signingKID string) (*KeyRing, error) {
+	if _, ok := keys[signingKID]; !ok {
+		return nil, fmt.Errorf("signing key %q is not in the key ring", signingKID)
+	}
+	return &KeyRing{
+		signingKID: signingKID,
+		keys:       keys,
+	}, nil
+}
+
+// LoadKeyRing reads every PEM encoded PKCS #8 Ed25519 private key in dir
+// whose name ends in ".pem". A key's ID is its file name without the
+// extension. An empty signingKID is allowed if dir holds a single key.
+func LoadKeyRing(dir, signingKID string) (*KeyRing, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]ed25519.PrivateKey, len(paths))
+	for _, path := range paths {
+		key, err := readPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys[strings.TrimSuffix(filepath.Base(path), ".pem")] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found in %v", dir)
+	}
+	if len(signingKID) == 0 {
+		if len(keys) > 1 {
+			return nil, errors.New("signing key must be chosen when there are several keys")
+		}
+		for kid := range keys {
+			signingKID = kid
+		}
+	}
+	return NewKeyRing(keys, signingKID)
+}
+
+// GenerateKeyRing returns a key ring with a single, freshly generated key.
+// Tokens it signs stop verifying once the process exits, so it is only fit
+// for development.
+func GenerateKeyRing() (*KeyRing, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid := base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)[:8])
+	return NewKeyRing(map[string]ed25519.PrivateKey{kid: key}, kid)
+}
+
+func readPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%v: not a PEM encoded private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%v: not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// AcceptLegacySecret makes the key ring verify HS256 tokens signed with
+// secret until until, by when tokens from before the key ring are expected
+// to have expired. An empty secret accepts none.
+func (k *KeyRing) AcceptLegacySecret(secret string, until time.Time) {
+	if len(secret) == 0 {
+		k.legacySecret = nil
+		k.legacyUntil = time.Time{}
+		return
+	}
+	k.legacySecret = []byte(secret)
+	k.legacyUntil = until
+}
+
+// SetIssuer makes the key ring sign tokens as issued by issuer, which is
+// expected to be the server's public URL, as in its OAuth metadata.
+func (k *KeyRing) SetIssuer(issuer string) {
+	k.issuer = issuer
+}
+
+// Issuer returns what the key ring signs tokens as issued by.
+func (k *KeyRing) Issuer() string {
+	return k.issuer
+}
+
+// acceptsLegacy reports whether HS256 tokens are still accepted.
+func (k *KeyRing) acceptsLegacy() bool {
+	return k.legacySecret != nil && time.Now().Before(k.legacyUntil)
+}
+
+// JWK is the public half of a key in the ring, as a JSON Web Key (RFC
+// 8037).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517).
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the ring, ordered by key ID.
+func (k *KeyRing) JWKS() JWKS {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		set.Keys = append(set.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(k.keys[kid].Public().(ed25519.PublicKey)),
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: "EdDSA",
+		})
+	}
+	return set
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// MakeOAuthSecret returns a random secret, such as a client secret or an
+// authorization code. Only its hash, see HashOAuthSecret, is to be stored.
+func MakeOAuthSecret() (string, error) {
+	randBytes := make([]byte, 32)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", fmt.Errorf("MakeOAuthSecret: %v", err)
+	}
+	return hex.EncodeToString(randBytes), nil
+}
+
+// HashOAuthSecret returns the form OAuth secrets are stored and looked up
+// in. They are random enough that a fast hash does.
+func HashOAuthSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsValidPKCEVerifier reports whether verifier is a well-formed PKCE code
+// verifier (RFC 7636, section 4.1).
+func IsValidPKCEVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		isUnreserved := 'A' <= c && c <= 'Z' ||
+			'a' <= c && c <= 'z' ||
+			'0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~'
+		if !isUnreserved {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyPKCE reports whether verifier matches the S256 code challenge
+// challenge (RFC 7636, section 4.6).
+func VerifyPKCE(verifier, challenge string) bool {
+	if !IsValidPKCEVerifier(verifier) {
+		return false
+	}
+	want := PKCEChallenge(verifier)
+	return subtle.ConstantTimeCompare([]byte(want), []byte(challenge)) == 1
+}
+
+// MakePKCEVerifier returns a random PKCE code verifier, for when Chirpy is
+// the client.
+func MakePKCEVerifier() (string, error) {
+	randBytes := make([]byte, 32)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", fmt.Errorf("MakePKCEVerifier: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(randBytes), nil
+}
+
+// PKCEChallenge returns the S256 code challenge of verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
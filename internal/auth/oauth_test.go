@@ -0,0 +1,72 @@
+package auth_test
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636, appendix B.
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+	tests := []struct {
+		name      string // description of this test case
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{
+			name:      "verifier matches",
+			verifier:  verifier,
+			challenge: challenge,
+			want:      true,
+		},
+		{
+			name:      "verifier does not match",
+			verifier:  strings.Repeat("a", 43),
+			challenge: challenge,
+			want:      false,
+		},
+		{
+			name:      "verifier is too short",
+			verifier:  verifier[:42],
+			challenge: challenge,
+			want:      false,
+		},
+		{
+			name:      "verifier has invalid characters",
+			verifier:  verifier[:42] + "+",
+			challenge: challenge,
+			want:      false,
+		},
+		{
+			name:      "plain challenge is not accepted",
+			verifier:  verifier,
+			challenge: verifier,
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auth.VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMakePKCEVerifier(t *testing.T) {
+	verifier, err := auth.MakePKCEVerifier()
+	if err != nil {
+		t.Fatalf("MakePKCEVerifier() error = %v", err)
+	}
+	if !auth.IsValidPKCEVerifier(verifier) {
+		t.Errorf("MakePKCEVerifier() = %q, not a valid verifier", verifier)
+	}
+	if !auth.VerifyPKCE(verifier, auth.PKCEChallenge(verifier)) {
+		t.Errorf("VerifyPKCE() = false for the challenge of %q", verifier)
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). They are the defaults authenticator apps
+// assume, so they are not configurable.
+const (
+	totpSecretSize = 20
+	totpDigits     = 6
+	totpPeriod     = 30 * time.Second
+	// totpSkew is how many periods a code may be off by either way, to
+	// allow for clock drift and for typing the code in.
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func MakeTOTPSecret() ([]byte, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("MakeTOTPSecret: %v", err)
+	}
+	return secret, nil
+}
+
+// EncodeTOTPSecret returns secret in the base32 form authenticator apps
+// take when it is typed in.
+func EncodeTOTPSecret(secret []byte) string {
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPProvisioningURI returns the otpauth URI that authenticator apps
+// enroll secret from, usually by scanning it as a QR code.
+func TOTPProvisioningURI(secret []byte, issuer, account string) string {
+	query := url.Values{}
+	query.Set("secret", EncodeTOTPSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return uri.String()
+}
+
+// TOTPStep returns the time step t falls in.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// TOTPCode returns the code of secret for the time step step.
+func TOTPCode(secret []byte, step int64) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	// Dynamic truncation (RFC 4226, section 5.3).
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// ValidateTOTP reports whether code is a code of secret at time t, and the
+// time step it matched. Codes of steps up to lastStep are rejected, so that
+// each code can only be used once.
+func ValidateTOTP(secret []byte, code string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	now := TOTPStep(t)
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(TOTPCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// MakeRecoveryCode returns a one-time code that stands in for a TOTP code
+// when the authenticator is lost. It is formatted as two groups of five
+// characters, which is easy to write down.
+func MakeRecoveryCode() (string, error) {
+	randBytes := make([]byte, 7)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", fmt.Errorf("MakeRecoveryCode: %v", err)
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(randBytes))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// HashRecoveryCode returns the form recovery codes are stored and looked
+// up in. Recovery codes are random enough that a fast hash does.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package auth_test
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 secret of the RFC 6238 test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238, appendix B, truncated to 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		got := auth.TOTPCode(rfc6238Secret, auth.TOTPStep(time.Unix(tt.unix, 0)))
+		if got != tt.want {
+			t.Errorf("TOTPCode() at %d = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := auth.TOTPStep(now)
+	tests := []struct {
+		name     string // description of this test case
+		code     string
+		lastStep int64
+		wantOK   bool
+	}{
+		{
+			name:     "current code is valid",
+			code:     auth.TOTPCode(rfc6238Secret, step),
+			lastStep: 0,
+			wantOK:   true,
+		},
+		{
+			name:     "previous code is valid",
+			code:     auth.TOTPCode(rfc6238Secret, step-1),
+			lastStep: 0,
+			wantOK:   true,
+		},
+		{
+			name:     "code from too long ago is invalid",
+			code:     auth.TOTPCode(rfc6238Secret, step-2),
+			lastStep: 0,
+			wantOK:   false,
+		},
+		{
+			name:     "used code is invalid",
+			code:     auth.TOTPCode(rfc6238Secret, step),
+			lastStep: step,
+			wantOK:   false,
+		},
+		{
+			name:     "malformed code is invalid",
+			code:     "12345",
+			lastStep: 0,
+			wantOK:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, gotOK := auth.ValidateTOTP(rfc6238Secret, tt.code, now, tt.lastStep)
+			if gotOK != tt.wantOK {
+				t.Errorf("ValidateTOTP() = %v, want %v", gotOK, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSecretBox(t *testing.T) {
+	box, err := auth.NewSecretBox(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := box.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if string(opened) != string(rfc6238Secret) {
+		t.Errorf("Open() = %q, want %q", opened, rfc6238Secret)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := box.Open(sealed); err == nil {
+		t.Error("Open() of tampered ciphertext succeeded unexpectedly")
+	}
+}
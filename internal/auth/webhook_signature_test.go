@@ -0,0 +1,98 @@
+package auth_test
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	const (
+		secret    = "whsec_test"
+		tolerance = 5 * time.Minute
+	)
+	body := []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	sentAt := time.Unix(1700000000, 0)
+	header := auth.SignWebhook(secret, sentAt, body)
+
+	tests := []struct {
+		name    string // description of this test case
+		header  string
+		body    []byte
+		secret  string
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name:   "valid signature",
+			header: header,
+			body:   body,
+			secret: secret,
+			now:    sentAt.Add(time.Minute),
+		},
+		{
+			name:   "one of several signatures matches",
+			header: "t=1700000000,v1=deadbeef," + header[len("t=1700000000,"):],
+			body:   body,
+			secret: secret,
+			now:    sentAt,
+		},
+		{
+			name:    "body is changed",
+			header:  header,
+			body:    []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"00000000-0000-0000-0000-000000000000"}}`),
+			secret:  secret,
+			now:     sentAt,
+			wantErr: auth.ErrWebhookSignature,
+		},
+		{
+			name:    "wrong secret",
+			header:  header,
+			body:    body,
+			secret:  "whsec_other",
+			now:     sentAt,
+			wantErr: auth.ErrWebhookSignature,
+		},
+		{
+			name:    "timestamp is changed",
+			header:  "t=1700000100" + header[len("t=1700000000"):],
+			body:    body,
+			secret:  secret,
+			now:     sentAt.Add(100 * time.Second),
+			wantErr: auth.ErrWebhookSignature,
+		},
+		{
+			name:    "replayed after the tolerance",
+			header:  header,
+			body:    body,
+			secret:  secret,
+			now:     sentAt.Add(tolerance + time.Second),
+			wantErr: auth.ErrWebhookTimestamp,
+		},
+		{
+			name:    "sent too far in the future",
+			header:  header,
+			body:    body,
+			secret:  secret,
+			now:     sentAt.Add(-tolerance - time.Second),
+			wantErr: auth.ErrWebhookTimestamp,
+		},
+		{
+			name:    "malformed header",
+			header:  "ApiKey f271c81ff7084ee5b99a5091b42d486e",
+			body:    body,
+			secret:  secret,
+			now:     sentAt,
+			wantErr: auth.ErrWebhookSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := auth.VerifyWebhookSignature(tt.header, tt.body, tt.secret, tt.now, tolerance)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("VerifyWebhookSignature() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
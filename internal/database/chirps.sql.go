@@ -10,22 +10,91 @@ import (
 	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countChirpReplies = `-- name: CountChirpReplies :many
+select in_reply_to, count(*) as reply_count
+from chirps
+where in_reply_to = any($1::uuid[])
+group by in_reply_to
+`
+
+type CountChirpRepliesRow struct {
+	InReplyTo  uuid.NullUUID
+	ReplyCount int64
+}
+
+func (q *Queries) CountChirpReplies(ctx context.Context, chirpIds []uuid.UUID) ([]CountChirpRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpReplies, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpRepliesRow
+	for rows.Next() {
+		var i CountChirpRepliesRow
+		if err := rows.Scan(&i.InReplyTo, &i.ReplyCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countRecentChirps = `-- name: CountRecentChirps :one
+select
+    count(*) as chirp_count,
+    coalesce(
+        extract(epoch from min(created_at) + make_interval(secs => $1::float) - now()),
+        0
+    )::float as retry_after_seconds
+from chirps
+where
+    user_id = $2
+    and created_at > now() - make_interval(secs => $1::float)
+`
+
+type CountRecentChirpsParams struct {
+	WindowSeconds float64
+	UserID        uuid.NullUUID
+}
+
+type CountRecentChirpsRow struct {
+	ChirpCount        int64
+	RetryAfterSeconds float64
+}
+
+// Counts the chirps of a user within the last window_seconds, and how
+// long until the earliest of them is out of it.
+func (q *Queries) CountRecentChirps(ctx context.Context, arg CountRecentChirpsParams) (CountRecentChirpsRow, error) {
+	row := q.db.QueryRowContext(ctx, countRecentChirps, arg.WindowSeconds, arg.UserID)
+	var i CountRecentChirpsRow
+	err := row.Scan(&i.ChirpCount, &i.RetryAfterSeconds)
+	return i, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-insert into chirps (id, created_at, updated_at, body, user_id)
-values (gen_random_uuid(), now(), now(), $1, $2)
+insert into chirps (id, created_at, updated_at, body, user_id, in_reply_to)
+values (gen_random_uuid(), now(), now(), $1, $2, $3)
 
-returning id, user_id, created_at, updated_at, body
+returning id, user_id, created_at, updated_at, body, search_vector, in_reply_to
 `
 
 type CreateChirpParams struct {
-	Body   sql.NullString
-	UserID uuid.NullUUID
+	Body      sql.NullString
+	UserID    uuid.NullUUID
+	InReplyTo uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.InReplyTo)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -33,6 +102,8 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Body,
+		&i.SearchVector,
+		&i.InReplyTo,
 	)
 	return i, err
 }
@@ -56,7 +127,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, arg DeleteChirpParams) (int64
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-select id, user_id, created_at, updated_at, body
+select id, user_id, created_at, updated_at, body, search_vector, in_reply_to
 from chirps
 order by created_at
 `
@@ -76,6 +147,8 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
+			&i.SearchVector,
+			&i.InReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -91,7 +164,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirp = `-- name: GetChirp :one
-select id, user_id, created_at, updated_at, body
+select id, user_id, created_at, updated_at, body, search_vector, in_reply_to
 from chirps
 where id = $1
 `
@@ -105,12 +178,232 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Body,
+		&i.SearchVector,
+		&i.InReplyTo,
 	)
 	return i, err
 }
 
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+with recursive ancestors (id, in_reply_to, depth) as (
+    select parent.id, parent.in_reply_to, 1
+    from chirps child
+    join chirps parent on parent.id = child.in_reply_to
+    where child.id = $1
+    union all
+    select parent.id, parent.in_reply_to, ancestors.depth + 1
+    from ancestors
+    join chirps parent on parent.id = ancestors.in_reply_to
+    where ancestors.depth < $2::int
+)
+select chirps.id, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.body, chirps.search_vector, chirps.in_reply_to
+from ancestors
+join chirps on chirps.id = ancestors.id
+order by ancestors.depth desc
+`
+
+type GetChirpAncestorsParams struct {
+	ChirpID  uuid.UUID
+	MaxDepth int32
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, arg GetChirpAncestorsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, arg.ChirpID, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.SearchVector,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+with recursive descendants (id, depth) as (
+    select id, 1
+    from chirps
+    where in_reply_to = $1
+    union all
+    select replies.id, descendants.depth + 1
+    from descendants
+    join chirps replies on replies.in_reply_to = descendants.id
+    where descendants.depth < $2::int
+)
+select chirps.id, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.body, chirps.search_vector, chirps.in_reply_to, descendants.depth::int as depth
+from descendants
+join chirps on chirps.id = descendants.id
+where $3::int is null
+    or (descendants.depth, chirps.created_at, chirps.id) > (
+        $3::int,
+        $4::timestamp,
+        $5::uuid
+    )
+order by descendants.depth, chirps.created_at, chirps.id
+limit $6
+`
+
+type GetChirpDescendantsParams struct {
+	ChirpID         uuid.NullUUID
+	MaxDepth        int32
+	CursorDepth     sql.NullInt32
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+type GetChirpDescendantsRow struct {
+	ID           uuid.UUID
+	UserID       uuid.NullUUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	Depth        int32
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants,
+		arg.ChirpID,
+		arg.MaxDepth,
+		arg.CursorDepth,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+select id, user_id, created_at, updated_at, body, search_vector, in_reply_to
+from chirps
+where id = $1
+for update
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.SearchVector,
+		&i.InReplyTo,
+	)
+	return i, err
+}
+
+const getTimelineChirps = `-- name: GetTimelineChirps :many
+select id, user_id, created_at, updated_at, body, search_vector, in_reply_to
+from chirps
+where user_id in (
+        select followee_id
+        from follows
+        where follower_id = $1
+    )
+    and (
+        $2::timestamp is null
+        or (created_at, id) < ($2::timestamp, $3::uuid)
+    )
+order by created_at desc, id desc
+limit $4
+`
+
+type GetTimelineChirpsParams struct {
+	FollowerID      uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) GetTimelineChirps(ctx context.Context, arg GetTimelineChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getTimelineChirps,
+		arg.FollowerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.SearchVector,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUsersChirps = `-- name: GetUsersChirps :many
-select id, user_id, created_at, updated_at, body
+select id, user_id, created_at, updated_at, body, search_vector, in_reply_to
 from chirps
 where user_id = $1
 order by created_at
@@ -131,6 +424,118 @@ func (q *Queries) GetUsersChirps(ctx context.Context, userID uuid.NullUUID) ([]C
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
+			&i.SearchVector,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAscending = `-- name: ListChirpsAscending :many
+select id, user_id, created_at, updated_at, body, search_vector, in_reply_to
+from chirps
+where ($1::uuid is null or user_id = $1::uuid)
+    and (
+        $2::timestamp is null
+        or (created_at, id) > ($2::timestamp, $3::uuid)
+    )
+order by created_at asc, id asc
+limit $4
+`
+
+type ListChirpsAscendingParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirpsAscending(ctx context.Context, arg ListChirpsAscendingParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAscending,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.SearchVector,
+			&i.InReplyTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDescending = `-- name: ListChirpsDescending :many
+select id, user_id, created_at, updated_at, body, search_vector, in_reply_to
+from chirps
+where ($1::uuid is null or user_id = $1::uuid)
+    and (
+        $2::timestamp is null
+        or (created_at, id) < ($2::timestamp, $3::uuid)
+    )
+order by created_at desc, id desc
+limit $4
+`
+
+type ListChirpsDescendingParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirpsDescending(ctx context.Context, arg ListChirpsDescendingParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDescending,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.SearchVector,
+			&i.InReplyTo,
 		); err != nil {
 			return nil, err
 		}
@@ -144,3 +549,101 @@ func (q *Queries) GetUsersChirps(ctx context.Context, userID uuid.NullUUID) ([]C
 	}
 	return items, nil
 }
+
+const searchChirps = `-- name: SearchChirps :many
+select
+    chirps.id, chirps.user_id, chirps.created_at, chirps.updated_at, chirps.body, chirps.search_vector, chirps.in_reply_to,
+    ts_rank(chirps.search_vector, query)::real as rank,
+    ts_headline(
+        'english',
+        replace(replace(replace(coalesce(chirps.body, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2'
+    )::text as snippet
+from chirps, to_tsquery('english', $1) query
+where chirps.search_vector @@ query
+    and ($2::uuid is null or chirps.user_id = $2::uuid)
+order by rank desc, chirps.created_at desc, chirps.id desc
+limit $3
+`
+
+type SearchChirpsParams struct {
+	Query    string
+	AuthorID uuid.NullUUID
+	RowLimit int32
+}
+
+type SearchChirpsRow struct {
+	ID           uuid.UUID
+	UserID       uuid.NullUUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	Rank         float32
+	Snippet      string
+}
+
+// The body is HTML-escaped before it is highlighted, so that the <mark>
+// tags are the only markup in the snippet.
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps, arg.Query, arg.AuthorID, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+update chirps
+set body = $2, updated_at = now()
+where id = $1
+
+returning id, user_id, created_at, updated_at, body, search_vector, in_reply_to
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body sql.NullString
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.SearchVector,
+		&i.InReplyTo,
+	)
+	return i, err
+}
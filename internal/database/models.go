@@ -6,16 +6,146 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
+	ID           uuid.UUID
+	UserID       uuid.NullUUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	EndOffset   int32
+	CreatedAt   time.Time
+}
+
+type ChirpRevision struct {
 	ID        uuid.UUID
-	UserID    uuid.NullUUID
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
-	Body      sql.NullString
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+	Body      string
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type LoginThrottle struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type Medium struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	ChirpID     uuid.NullUUID
+	Position    sql.NullInt32
+	CreatedAt   time.Time
+	StorageKey  string
+	ContentType string
+	SizeBytes   int64
+	Width       int32
+	Height      int32
+	AltText     string
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type OneTimeToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash         string
+	ClientID         string
+	UserID           uuid.UUID
+	RedirectUri      string
+	Scopes           []string
+	CodeChallenge    string
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+	UsedAt           sql.NullTime
+	SessionID        uuid.NullUUID
+	RedirectUriGiven bool
+}
+
+type OauthClient struct {
+	ID           string
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	Scopes       []string
+	CreatedAt    time.Time
+}
+
+type OutboxEvent struct {
+	ID           uuid.UUID
+	EventType    string
+	UserID       uuid.NullUUID
+	Payload      json.RawMessage
+	CreatedAt    time.Time
+	DispatchedAt sql.NullTime
+	Seq          int64
+	Xid          interface{}
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	CodeHash  string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
@@ -25,13 +155,103 @@ type RefreshToken struct {
 	UserID    uuid.NullUUID
 	ExpiresAt sql.NullTime
 	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+	RotatedAt sql.NullTime
+}
+
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	UserAgent  string
+	IpAddress  string
+	RevokedAt  sql.NullTime
+	ClientID   sql.NullString
+	Scopes     []string
+}
+
+type Subscription struct {
+	UserID             uuid.UUID
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
 }
 
 type User struct {
+	ID              uuid.UUID
+	CreatedAt       sql.NullTime
+	UpdatedAt       sql.NullTime
+	Email           sql.NullString
+	HashedPassword  string
+	Handle          sql.NullString
+	DisplayName     string
+	Bio             string
+	EmailVerifiedAt sql.NullTime
+}
+
+type UserIdentity struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Issuer      string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       []byte
+	CreatedAt    time.Time
+	EnabledAt    sql.NullTime
+	LastUsedStep int64
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	EndpointID    uuid.UUID
+	EventID       uuid.UUID
+	Status        string
+	Attempts      int32
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type WebhookDeliveryAttempt struct {
+	ID          uuid.UUID
+	DeliveryID  uuid.UUID
+	AttemptedAt time.Time
+	StatusCode  sql.NullInt32
+	Error       sql.NullString
+	DurationMs  int32
+}
+
+type WebhookEndpoint struct {
+	ID                  uuid.UUID
+	UserID              uuid.NullUUID
+	Url                 string
+	EventTypes          []string
+	Secret              string
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	ConsecutiveFailures int32
+	DisabledAt          sql.NullTime
+}
+
+type WebhookEvent struct {
 	ID             uuid.UUID
-	CreatedAt      sql.NullTime
-	UpdatedAt      sql.NullTime
-	Email          sql.NullString
-	HashedPassword string
-	IsChirpyRed    sql.NullBool
+	Provider       string
+	EventID        string
+	EventType      string
+	Payload        json.RawMessage
+	ReceivedAt     time.Time
+	LastReceivedAt time.Time
+	Deliveries     int32
+	ProcessedAt    sql.NullTime
+	Attempts       int32
+	LastError      sql.NullString
 }
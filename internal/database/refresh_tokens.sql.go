@@ -12,19 +12,20 @@ import (
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-insert into refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
-values ($1, now(), now(), $2, now() + interval '60 days', null)
+insert into refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+values ($1, now(), now(), $2, now() + interval '60 days', null, $3)
 
-returning token, created_at, updated_at, user_id, expires_at, revoked_at
+returning token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token  string
-	UserID uuid.NullUUID
+	Token    string
+	UserID   uuid.NullUUID
+	FamilyID uuid.UUID
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.FamilyID)
 	var i RefreshToken
 	err := row.Scan(
 		&i.Token,
@@ -33,12 +34,14 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
 	)
 	return i, err
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-select token, created_at, updated_at, user_id, expires_at, revoked_at
+select token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at
 from refresh_tokens
 where token = $1 and revoked_at is null and now() <= expires_at
 `
@@ -53,19 +56,80 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshTok
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
 	)
 	return i, err
 }
 
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+select token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at
+from refresh_tokens
+where token = $1
+for update
+`
+
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, token string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenForUpdate, token)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+	)
+	return i, err
+}
+
+const revokeAllRefreshTokens = `-- name: RevokeAllRefreshTokens :exec
+update refresh_tokens
+set revoked_at = now(), updated_at = now()
+where user_id = $1 and revoked_at is null
+`
+
+func (q *Queries) RevokeAllRefreshTokens(ctx context.Context, userID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokens, userID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 update refresh_tokens
 set revoked_at = now(), updated_at = now()
 where token = $1
 
-returning token, created_at, updated_at, user_id, expires_at, revoked_at
+returning token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at
 `
 
 func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
 	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
 	return err
 }
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :execrows
+update refresh_tokens
+set revoked_at = now(), updated_at = now()
+where family_id = $1 and revoked_at is null
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :exec
+update refresh_tokens
+set revoked_at = now(), rotated_at = now(), updated_at = now()
+where token = $1
+`
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, token string) error {
+	_, err := q.db.ExecContext(ctx, rotateRefreshToken, token)
+	return err
+}
@@ -10,13 +10,50 @@ import (
 	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countPasswordHashParams = `-- name: CountPasswordHashParams :many
+select split_part(hashed_password, '$', 4)::text as params, count(*) as users
+from users
+where hashed_password like '$argon2id$%'
+group by params
+order by users desc
+`
+
+type CountPasswordHashParamsRow struct {
+	Params string
+	Users  int64
+}
+
+func (q *Queries) CountPasswordHashParams(ctx context.Context) ([]CountPasswordHashParamsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countPasswordHashParams)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountPasswordHashParamsRow
+	for rows.Next() {
+		var i CountPasswordHashParamsRow
+		if err := rows.Scan(&i.Params, &i.Users); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createUser = `-- name: CreateUser :one
 insert into users (id, created_at, updated_at, email, hashed_password)
 values (gen_random_uuid(), now(), now(), $1, $2)
 
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, handle, display_name, bio, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -33,7 +70,34 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const createUserWithVerifiedEmail = `-- name: CreateUserWithVerifiedEmail :one
+insert into users (id, created_at, updated_at, email, email_verified_at)
+values (gen_random_uuid(), now(), now(), $1, now())
+
+returning id, created_at, updated_at, email, hashed_password, handle, display_name, bio, email_verified_at
+`
+
+func (q *Queries) CreateUserWithVerifiedEmail(ctx context.Context, email sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, createUserWithVerifiedEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -41,7 +105,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 const deleteAllUsers = `-- name: DeleteAllUsers :exec
 delete from users
 
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, handle, display_name, bio, email_verified_at
 `
 
 func (q *Queries) DeleteAllUsers(ctx context.Context) error {
@@ -49,8 +113,43 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const getChirpAuthors = `-- name: GetChirpAuthors :many
+select id, handle, display_name
+from users
+where id = any($1::uuid[])
+`
+
+type GetChirpAuthorsRow struct {
+	ID          uuid.UUID
+	Handle      sql.NullString
+	DisplayName string
+}
+
+func (q *Queries) GetChirpAuthors(ctx context.Context, userIds []uuid.UUID) ([]GetChirpAuthorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAuthors, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAuthorsRow
+	for rows.Next() {
+		var i GetChirpAuthorsRow
+		if err := rows.Scan(&i.ID, &i.Handle, &i.DisplayName); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUser = `-- name: GetUser :one
-select id, created_at, updated_at, email, hashed_password, is_chirpy_red
+select id, created_at, updated_at, email, hashed_password, handle, display_name, bio, email_verified_at
 from users
 where email = $1
 `
@@ -64,17 +163,160 @@ func (q *Queries) GetUser(ctx context.Context, email sql.NullString) (User, erro
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+select id, created_at, updated_at, email, hashed_password, handle, display_name, bio, email_verified_at
+from users
+where lower(handle) = lower($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+select id, created_at, updated_at, email, hashed_password, handle, display_name, bio, email_verified_at
+from users
+where id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const getUsersByHandles = `-- name: GetUsersByHandles :many
+select id, handle
+from users
+where lower(handle) = any($1::text[])
+`
+
+type GetUsersByHandlesRow struct {
+	ID     uuid.UUID
+	Handle sql.NullString
+}
+
+func (q *Queries) GetUsersByHandles(ctx context.Context, handles []string) ([]GetUsersByHandlesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByHandlesRow
+	for rows.Next() {
+		var i GetUsersByHandlesRow
+		if err := rows.Scan(&i.ID, &i.Handle); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUser = `-- name: LockUser :exec
+select id
+from users
+where id = $1
+for no key update
+`
+
+// Locks a user's row until the end of the transaction, so that what is
+// checked against it, such as rate limits, is checked one at a time.
+func (q *Queries) LockUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, lockUser, id)
+	return err
+}
+
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :execrows
+update users
+set email_verified_at = now(), updated_at = now()
+where id = $1 and email = $2
+`
+
+type MarkUserEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email sql.NullString
+}
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, arg MarkUserEmailVerifiedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markUserEmailVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :execrows
+update users
+set hashed_password = $1
+where id = $2 and hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+// Only replaces the hash it was made from, so that a password changed in
+// the meantime is kept.
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateUser = `-- name: UpdateUser :one
 update users
-set email = $2, hashed_password = $3, updated_at = now()
+set
+    email = $2,
+    hashed_password = $3,
+    -- a new email has to be verified again
+    email_verified_at = case when users.email = $2 then users.email_verified_at end,
+    updated_at = now()
 where id = $1
 
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, handle, display_name, bio, email_verified_at
 `
 
 type UpdateUserParams struct {
@@ -92,21 +334,56 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
-const upgradeUserToRed = `-- name: UpgradeUserToRed :one
+const updateUserPassword = `-- name: UpdateUserPassword :exec
 update users
-set is_chirpy_red = true, updated_at = now()
+set hashed_password = $2, updated_at = now()
 where id = $1
+`
 
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+update users
+set
+    handle = coalesce($1, handle),
+    display_name = coalesce($2, display_name),
+    bio = coalesce($3, bio),
+    updated_at = now()
+where id = $4
+
+returning id, created_at, updated_at, email, hashed_password, handle, display_name, bio, email_verified_at
 `
 
-func (q *Queries) UpgradeUserToRed(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, upgradeUserToRed, id)
+type UpdateUserProfileParams struct {
+	Handle      sql.NullString
+	DisplayName sql.NullString
+	Bio         sql.NullString
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -114,7 +391,10 @@ func (q *Queries) UpgradeUserToRed(ctx context.Context, id uuid.UUID) (User, err
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
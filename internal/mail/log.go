@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Log is a Mailer that writes emails to w instead of sending them, for
+// development.
+type Log struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLog(w io.Writer, from string) *Log {
+	return &Log{
+		w:    w,
+		from: from,
+	}
+}
+
+func (l *Log) Send(ctx context.Context, m Message) error {
+	msg, err := m.format(l.from)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := fmt.Fprintf(l.w, "----- mail -----\n%s\n----------------\n", msg); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package mail_test
+
+import (
+	"ValenTheRed/chirpy/internal/mail"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	var b strings.Builder
+	mailer := mail.NewLog(&b, "chirpy@example.com")
+	ctx := context.Background()
+
+	if err := mailer.Send(ctx, mail.Message{
+		To:      "user@example.com",
+		Subject: "Hello",
+		Body:    "line one\nline two",
+	}); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"From: chirpy@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: Hello\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("mail %q does not contain %q", got, want)
+		}
+	}
+
+	err := mailer.Send(ctx, mail.Message{
+		To:      "user@example.com\r\nBcc: victim@example.com",
+		Subject: "Hello",
+	})
+	if !errors.Is(err, mail.ErrInvalidHeader) {
+		t.Errorf("Send() with newline in To = %v, want %v", err, mail.ErrInvalidHeader)
+	}
+}
@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTP is a Mailer that sends through an SMTP server.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP returns an SMTP mailer that sends from from through the server at
+// addr, a host:port. It authenticates with username and password, unless
+// username is empty.
+func NewSMTP(addr, username, password, from string) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("mail: %w", err)
+	}
+	var auth smtp.Auth
+	if len(username) > 0 {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTP{
+		addr: addr,
+		auth: auth,
+		from: from,
+	}, nil
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	msg, err := m.format(s.from)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, msg); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+// Package oidc signs users in with an external OpenID Connect provider,
+// using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidIDToken is returned for ID tokens that do not validate.
+var ErrInvalidIDToken = errors.New("oidc: invalid ID token")
+
+// keysRefreshInterval is how often, at most, the provider's keys are
+// fetched again for a token signed with a key that is not known yet.
+const keysRefreshInterval = time.Minute
+
+// signingMethods are the algorithms ID tokens may be signed with. Each
+// only verifies with keys of its own type, so that a key cannot be used
+// for another algorithm.
+var signingMethods = []string{"RS256", "ES256", "EdDSA"}
+
+// Config is how Chirpy is registered with a provider.
+type Config struct {
+	// Issuer is the provider's issuer identifier, from which its
+	// configuration is discovered.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends users back to.
+	RedirectURL string
+	// Scopes are requested in addition to openid.
+	Scopes []string
+}
+
+// metadata is the part of a provider's configuration that is used
+// (OpenID Connect Discovery 1.0, section 3).
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider.
+type Provider struct {
+	config   Config
+	client   *http.Client
+	metadata metadata
+
+	mu            sync.Mutex
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// Discover fetches the configuration of the provider config.Issuer.
+// client is used for every request to the provider.
+func Discover(ctx context.Context, config Config, client *http.Client) (*Provider, error) {
+	u := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	p := &Provider{
+		config: config,
+		client: client,
+	}
+	if err := p.getJSON(ctx, u, &p.metadata); err != nil {
+		return nil, fmt.Errorf("oidc: discovering %v: %w", config.Issuer, err)
+	}
+	// The issuer must be exactly the one asked for, lest a provider
+	// vouch for another's users (section 4.3).
+	if p.metadata.Issuer != config.Issuer {
+		return nil, fmt.Errorf("oidc: discovered issuer %q does not match %q", p.metadata.Issuer, config.Issuer)
+	}
+	if len(p.metadata.AuthorizationEndpoint) == 0 ||
+		len(p.metadata.TokenEndpoint) == 0 ||
+		len(p.metadata.JWKSURI) == 0 {
+		return nil, fmt.Errorf("oidc: configuration of %v is missing endpoints", config.Issuer)
+	}
+	return p, nil
+}
+
+// Issuer returns the provider's issuer identifier.
+func (p *Provider) Issuer() string {
+	return p.metadata.Issuer
+}
+
+// AuthCodeURL returns where to send users to sign in. codeChallenge is the
+// S256 challenge of the code verifier later passed to Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	u, err := url.Parse(p.metadata.AuthorizationEndpoint)
+	if err != nil {
+		// An unparsable endpoint fails the sign in at the provider.
+		return p.metadata.AuthorizationEndpoint
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, p.config.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Error is an error response of the provider's token endpoint.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("oidc: provider error %v: %v", e.Code, e.Description)
+}
+
+// Exchange exchanges an authorization code for the signed in user's claims.
+// The ID token is validated, nonce included, before any of its claims are
+// returned.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if len(p.config.ClientSecret) == 0 {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(p.config.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("oidc: exchanging code: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return Claims{}, fmt.Errorf("oidc: exchanging code: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		providerErr := &Error{}
+		if err := json.Unmarshal(body, providerErr); err != nil || len(providerErr.Code) == 0 {
+			return Claims{}, fmt.Errorf("oidc: exchanging code: status %v", res.Status)
+		}
+		return Claims{}, providerErr
+	}
+	token := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return Claims{}, fmt.Errorf("oidc: exchanging code: %w", err)
+	}
+	if len(token.IDToken) == 0 {
+		return Claims{}, fmt.Errorf("%w: none in token response", ErrInvalidIDToken)
+	}
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// Claims are what an ID token says about the signed in user.
+type Claims struct {
+	// Subject identifies the user at the provider. Unlike their email,
+	// it never changes.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	Name            string `json:"name"`
+}
+
+// VerifyIDToken validates an ID token issued for the client with nonce
+// (OpenID Connect Core 1.0, section 3.1.3.7).
+func (p *Provider) VerifyIDToken(ctx context.Context, idToken, nonce string) (Claims, error) {
+	c := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(
+		idToken,
+		c,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.key(ctx, kid)
+		},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if len(c.Audience) > 1 && c.AuthorizedParty != p.config.ClientID {
+		return Claims{}, fmt.Errorf("%w: authorized party is %q", ErrInvalidIDToken, c.AuthorizedParty)
+	}
+	if len(nonce) == 0 || subtle.ConstantTimeCompare([]byte(c.Nonce), []byte(nonce)) != 1 {
+		return Claims{}, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+	if len(c.Subject) == 0 {
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return Claims{
+		Subject:       c.Subject,
+		Email:         c.Email,
+		EmailVerified: c.EmailVerified,
+		Name:          c.Name,
+	}, nil
+}
+
+// key returns the provider's key kid. The provider's keys are fetched
+// again for an unknown kid, so that keys it rotates in are picked up.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	set := jwks{}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+	p.keys = set.publicKeys()
+	p.keysFetchedAt = time.Now()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+// lookupKey returns the key kid. Tokens without a kid are only accepted
+// from providers with a single key.
+func (p *Provider) lookupKey(kid string) (any, bool) {
+	if len(kid) == 0 && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v: status %v", u, res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
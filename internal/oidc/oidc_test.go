@@ -0,0 +1,191 @@
+package oidc_test
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/oidc"
+	"ValenTheRed/chirpy/internal/oidc/oidctest"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const redirectURL = "http://localhost:8080/api/login/oidc/callback"
+
+// signIn goes through the server's authorization endpoint and returns the
+// code it redirects back with.
+func signIn(t *testing.T, p *oidc.Provider, state, nonce, verifier string) string {
+	t.Helper()
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get(p.AuthCodeURL(state, nonce, auth.PKCEChallenge(verifier)))
+	if err != nil {
+		t.Fatalf("GET authorization endpoint: %v", err)
+	}
+	res.Body.Close()
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing redirect: %v", err)
+	}
+	if got := location.Query().Get("state"); got != state {
+		t.Fatalf("redirect state = %q, want %q", got, state)
+	}
+	return location.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	user := oidctest.User{
+		Subject:       "248289761001",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane Doe",
+	}
+	tests := []struct {
+		name          string // description of this test case
+		clientSecret  string
+		idTokenClaims func(jwt.MapClaims)
+		// nonce is the one Exchange is given, the server is given
+		// "nonce".
+		nonce   string
+		want    oidc.Claims
+		wantErr bool
+	}{
+		{
+			name:         "confidential client",
+			clientSecret: "secret",
+			nonce:        "nonce",
+			want: oidc.Claims{
+				Subject:       user.Subject,
+				Email:         user.Email,
+				EmailVerified: true,
+				Name:          user.Name,
+			},
+		},
+		{
+			name:  "public client",
+			nonce: "nonce",
+			want: oidc.Claims{
+				Subject:       user.Subject,
+				Email:         user.Email,
+				EmailVerified: true,
+				Name:          user.Name,
+			},
+		},
+		{
+			name:    "nonce does not match",
+			nonce:   "other nonce",
+			wantErr: true,
+		},
+		{
+			name:  "issued for another client",
+			nonce: "nonce",
+			idTokenClaims: func(c jwt.MapClaims) {
+				c["aud"] = "other-client"
+			},
+			wantErr: true,
+		},
+		{
+			name:  "issued for several clients without an authorized party",
+			nonce: "nonce",
+			idTokenClaims: func(c jwt.MapClaims) {
+				c["aud"] = []string{"chirpy", "other-client"}
+			},
+			wantErr: true,
+		},
+		{
+			name:  "issued by another issuer",
+			nonce: "nonce",
+			idTokenClaims: func(c jwt.MapClaims) {
+				c["iss"] = "https://attacker.example.com"
+			},
+			wantErr: true,
+		},
+		{
+			name:  "expired",
+			nonce: "nonce",
+			idTokenClaims: func(c jwt.MapClaims) {
+				c["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := oidctest.NewServer("chirpy", tt.clientSecret)
+			defer server.Close()
+			server.SignIn(user)
+			server.IDTokenClaims = tt.idTokenClaims
+
+			p, err := oidc.Discover(context.Background(), oidc.Config{
+				Issuer:       server.Issuer(),
+				ClientID:     "chirpy",
+				ClientSecret: tt.clientSecret,
+				RedirectURL:  redirectURL,
+				Scopes:       []string{"email", "profile"},
+			}, server.Client())
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+			verifier, err := auth.MakePKCEVerifier()
+			if err != nil {
+				t.Fatalf("MakePKCEVerifier() error = %v", err)
+			}
+			code := signIn(t, p, "state", "nonce", verifier)
+
+			got, err := p.Exchange(context.Background(), code, verifier, tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, oidc.ErrInvalidIDToken) {
+					t.Errorf("Exchange() error = %v, want %v", err, oidc.ErrInvalidIDToken)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Exchange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "")
+	defer server.Close()
+	p, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:      server.Issuer(),
+		ClientID:    "chirpy",
+		RedirectURL: redirectURL,
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	verifier, _ := auth.MakePKCEVerifier()
+	otherVerifier, _ := auth.MakePKCEVerifier()
+	code := signIn(t, p, "state", "nonce", verifier)
+
+	_, err = p.Exchange(context.Background(), code, otherVerifier, "nonce")
+	providerErr := &oidc.Error{}
+	if !errors.As(err, &providerErr) || providerErr.Code != "invalid_grant" {
+		t.Errorf("Exchange() error = %v, want invalid_grant", err)
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "")
+	defer server.Close()
+	_, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:   server.Issuer() + "/",
+		ClientID: "chirpy",
+	}, server.Client())
+	if err == nil {
+		t.Errorf("Discover() error = nil, want an issuer mismatch")
+	}
+}
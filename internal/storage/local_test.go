@@ -0,0 +1,59 @@
+package storage_test
+
+import (
+	"ValenTheRed/chirpy/internal/storage"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocal(dir, "/media/")
+	if err != nil {
+		t.Fatalf("NewLocal() failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "blob.png", strings.NewReader("content")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "blob.png"))
+	if err != nil {
+		t.Fatalf("blob was not written: %v", err)
+	}
+	if string(got) != "content" {
+		t.Errorf("blob = %q, want %q", got, "content")
+	}
+	if url := store.URL("blob.png"); url != "/media/blob.png" {
+		t.Errorf("URL() = %q, want %q", url, "/media/blob.png")
+	}
+
+	if err := store.Delete(ctx, "blob.png"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blob.png")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("blob still exists after Delete(): %v", err)
+	}
+	if err := store.Delete(ctx, "blob.png"); err != nil {
+		t.Errorf("Delete() of a missing blob failed: %v", err)
+	}
+}
+
+func TestLocalInvalidKey(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("NewLocal() failed: %v", err)
+	}
+	for _, key := range []string{"", "../escape", "nested/blob", ".hidden"} {
+		t.Run(key, func(t *testing.T) {
+			err := store.Put(context.Background(), key, strings.NewReader("content"))
+			if !errors.Is(err, storage.ErrInvalidKey) {
+				t.Errorf("Put(%q) = %v, want %v", key, err, storage.ErrInvalidKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// Package storage keeps the blobs of uploaded media.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrInvalidKey is returned for keys that are not a single path segment.
+var ErrInvalidKey = errors.New("storage: invalid key")
+
+// Store keeps blobs by key. Keys are chosen by the caller and are a single
+// path segment, such as a UUID with a file extension.
+type Store interface {
+	// Put stores the content of r under key, replacing any earlier blob.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Delete removes the blob under key. Deleting a missing blob is not
+	// an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns where clients can fetch the blob under key.
+	URL(key string) string
+}
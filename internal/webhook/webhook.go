@@ -0,0 +1,149 @@
+// Package webhook sends signed webhooks to the endpoints of subscribers.
+package webhook
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the signature of a webhook, see
+	// auth.SignWebhook.
+	SignatureHeader = "Chirpy-Signature"
+	// EventHeader carries the type of the event a webhook is about.
+	EventHeader = "Chirpy-Event"
+	// DeliveryHeader carries the id of a delivery, which is the same on
+	// every attempt at it, so that receivers can drop retries of what they
+	// already handled.
+	DeliveryHeader = "Chirpy-Delivery"
+)
+
+// ErrNonPublicAddress is returned for endpoints that resolve to an address
+// that is not public, such as a loopback or private one.
+var ErrNonPublicAddress = errors.New("webhook: address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which
+// netip does not count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Message is a webhook to send.
+type Message struct {
+	URL        string
+	Secret     string
+	DeliveryID string
+	Event      string
+	Body       []byte
+}
+
+// StatusError is returned when an endpoint responds with a status other
+// than 2xx.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook: endpoint responded with %d", e.StatusCode)
+}
+
+// MakeSecret returns a random secret for a subscriber to verify webhooks
+// with. Unlike other secrets, it is needed in full to sign webhooks, so it
+// is stored as is.
+func MakeSecret() (string, error) {
+	randBytes := make([]byte, 32)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", fmt.Errorf("MakeSecret: %v", err)
+	}
+	return "whsec_" + hex.EncodeToString(randBytes), nil
+}
+
+// NewClient returns a client to send webhooks with, which gives up on an
+// endpoint after timeout. Unless allowPrivate is set, it only connects to
+// public addresses, so that webhooks cannot be pointed at services on the
+// internal network. Redirects are not followed.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// The check is made on the address being connected to, after
+		// resolution, so that a name cannot resolve to a private address
+		// once it has been checked.
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublic(addrPort.Addr()) {
+				return fmt.Errorf("%w: %v", ErrNonPublicAddress, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// Send posts m to its endpoint, signed with its secret at now. It returns
+// the status code of the response, which is 0 if there was none, and a
+// StatusError if it is not 2xx.
+func Send(ctx context.Context, client *http.Client, m Message, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL, bytes.NewReader(m.Body))
+	if err != nil {
+		return 0, fmt.Errorf("webhook: creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks")
+	req.Header.Set(SignatureHeader, auth.SignWebhook(m.Secret, now, m.Body))
+	req.Header.Set(EventHeader, m.Event)
+	req.Header.Set(DeliveryHeader, m.DeliveryID)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// The body is drained, up to a point, so that the connection can be
+	// reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff returns how long to wait after the failed attempt number attempt,
+// counting from 1. The wait starts at base and doubles with every attempt,
+// up to limit.
+func Backoff(attempt int, base, limit time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= limit {
+			return limit
+		}
+	}
+	return min(wait, limit)
+}
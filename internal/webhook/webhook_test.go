@@ -0,0 +1,119 @@
+package webhook_test
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/webhook"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":"9b1f0f5e-8a47-4c43-a8b4-0e5d1a3c2f10","event":"chirp.created","data":{}}`)
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name       string // description of this test case
+		status     int
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name:       "accepted",
+			status:     http.StatusNoContent,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "rejected",
+			status:     http.StatusInternalServerError,
+			wantStatus: http.StatusInternalServerError,
+			wantErr:    true,
+		},
+		{
+			name:       "redirect is not followed",
+			status:     http.StatusFound,
+			wantStatus: http.StatusFound,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ := io.ReadAll(r.Body)
+				if err := auth.VerifyWebhookSignature(
+					r.Header.Get(webhook.SignatureHeader), got, secret, now, time.Minute,
+				); err != nil {
+					t.Errorf("signature does not verify: %v", err)
+				}
+				if event := r.Header.Get(webhook.EventHeader); event != "chirp.created" {
+					t.Errorf("%v = %q, want %q", webhook.EventHeader, event, "chirp.created")
+				}
+				if id := r.Header.Get(webhook.DeliveryHeader); id != "delivery-1" {
+					t.Errorf("%v = %q, want %q", webhook.DeliveryHeader, id, "delivery-1")
+				}
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			status, err := webhook.Send(context.Background(), webhook.NewClient(time.Second, true), webhook.Message{
+				URL:        server.URL,
+				Secret:     secret,
+				DeliveryID: "delivery-1",
+				Event:      "chirp.created",
+				Body:       body,
+			}, now)
+			if status != tt.wantStatus {
+				t.Errorf("Send() status = %v, want %v", status, tt.wantStatus)
+			}
+			var statusErr *webhook.StatusError
+			if gotErr := errors.As(err, &statusErr); gotErr != tt.wantErr {
+				t.Errorf("Send() error = %v, want StatusError %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback address")
+	}))
+	defer server.Close()
+
+	_, err := webhook.Send(context.Background(), webhook.NewClient(time.Second, false), webhook.Message{
+		URL:    server.URL,
+		Secret: "whsec_test",
+	}, time.Now())
+	if !errors.Is(err, webhook.ErrNonPublicAddress) {
+		t.Errorf("Send() error = %v, want %v", err, webhook.ErrNonPublicAddress)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	const (
+		base  = time.Minute
+		limit = time.Hour
+	)
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Minute},
+		{attempt: 2, want: 2 * time.Minute},
+		{attempt: 4, want: 8 * time.Minute},
+		{attempt: 7, want: time.Hour},
+		{attempt: 100, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhook.Backoff(tt.attempt, base, limit); got != tt.want {
+			t.Errorf("Backoff(%v) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"net/http"
+)
+
+// jwksHandler publishes the public keys JWTs are verified with, so that
+// other services can verify Chirpy tokens without holding a secret.
+func jwksHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	// Caching is kept short, so that keys added to the ring are picked
+	// up well before they start signing.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	jsonResponse(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
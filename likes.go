@@ -0,0 +1,154 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func likeChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST chirp likes: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsWrite)
+	if err != nil {
+		log.Printf("POST chirp likes: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeChirpsWrite)
+		return
+	}
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("POST chirp likes: error while parsing chirp ID: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Liking a chirp twice is not an error, the second like is a no-op.
+	_, err = cfg.dbQueries.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if isPQError(err, foreignKeyViolation) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("POST chirp likes: error in liking chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func unlikeChirpHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("DELETE chirp likes: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsWrite)
+	if err != nil {
+		log.Printf("DELETE chirp likes: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeChirpsWrite)
+		return
+	}
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("DELETE chirp likes: error while parsing chirp ID: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if _, err := cfg.dbQueries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	}); err != nil {
+		log.Printf("DELETE chirp likes: error in unliking chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listChirpLikesHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload chirpLikesPage
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("GET chirp likes: error while parsing chirp ID: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid chirp ID",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET chirp likes: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	cursorCreatedAt, cursorUserID, err := parsePageCursor(query.Get("cursor"))
+	if err != nil {
+		log.Printf("GET chirp likes: error in decoding cursor: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid cursor",
+		})
+		return
+	}
+
+	if _, err := cfg.dbQueries.GetChirp(r.Context(), chirpID); errors.Is(err, sql.ErrNoRows) {
+		jsonResponse(w, http.StatusNotFound, errorPayload{
+			Error: "Chirp not found",
+		})
+		return
+	} else if err != nil {
+		log.Printf("GET chirp likes: error in retrieving chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// One extra row is fetched to know whether a next page exists.
+	likes, err := cfg.dbQueries.GetChirpLikes(r.Context(), database.GetChirpLikesParams{
+		ChirpID:         chirpID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorUserID:    cursorUserID,
+		RowLimit:        limit + 1,
+	})
+	if err != nil {
+		log.Printf("GET chirp likes: error in retrieving likes: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(likes) > int(limit) {
+		likes = likes[:limit]
+		last := likes[len(likes)-1]
+		response.NextCursor = pageCursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.UserID,
+		}.encode()
+	}
+	response.Likes = make([]chirpLike, 0, len(likes))
+	for _, like := range likes {
+		response.Likes = append(response.Likes, chirpLike{
+			UserID:    like.UserID,
+			CreatedAt: like.CreatedAt,
+		})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"ValenTheRed/chirpy/internal/auth"
 	"ValenTheRed/chirpy/internal/database"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -35,12 +38,30 @@ func loginHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Lockouts are checked before the password, so that locked out
+	// attempts cost no hashing.
+	throttles := []loginThrottle{
+		accountLoginThrottle(request.Email),
+		ipLoginThrottle(r),
+	}
+	if retryAfter, err := loginLockout(r.Context(), cfg, throttles...); err != nil {
+		log.Printf("Error in checking login lockout: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if retryAfter > 0 {
+		writeLoginLockout(w, retryAfter)
+		return
+	}
+
 	requester, err := cfg.dbQueries.GetUser(r.Context(), sql.NullString{
 		Valid:  true,
 		String: request.Email,
 	})
 	if err != nil {
 		log.Printf("Error in finding user: %v\n", err)
+		if err := recordLoginFailure(r.Context(), cfg, throttles...); err != nil {
+			log.Printf("Error in recording login failure: %v\n", err)
+		}
 		jsonResponse(w, http.StatusUnauthorized, errorPayload{
 			Error: unauthorizedLoginErrorMessage,
 		})
@@ -52,65 +73,192 @@ func loginHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 		requester.HashedPassword,
 	); err != nil {
 		log.Printf("Error in comparing hashed password and password: %v\n", err)
+		if err := recordLoginFailure(r.Context(), cfg, throttles...); err != nil {
+			log.Printf("Error in recording login failure: %v\n", err)
+		}
 		jsonResponse(w, http.StatusUnauthorized, errorPayload{
 			Error: unauthorizedLoginErrorMessage,
 		})
 		return
 	} else if !match {
 		log.Printf("Error: user's password does not match\n")
+		if err := recordLoginFailure(r.Context(), cfg, throttles...); err != nil {
+			log.Printf("Error in recording login failure: %v\n", err)
+		}
 		jsonResponse(w, http.StatusUnauthorized, errorPayload{
 			Error: unauthorizedLoginErrorMessage,
 		})
 		return
 	}
 
-	token, err := auth.MakeJWT(requester.ID, cfg.tokenSecret, time.Hour)
+	if _, err := clearLoginFailures(r.Context(), cfg, throttles[0]); err != nil {
+		log.Printf("Error in clearing login failures: %v\n", err)
+	}
+	upgradePasswordHash(r.Context(), cfg, requester, request.Password)
+
+	// The password only gets the user as far as the second step.
+	if challenge, err := twoFactorChallenge(r.Context(), cfg, requester.ID); err != nil {
+		log.Printf("Error in challenge token creation: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if challenge != nil {
+		jsonResponse(w, http.StatusOK, challenge)
+		return
+	}
+
+	token, refreshToken, err := issueTokens(cfg, r, requester.ID)
 	if err != nil {
-		log.Printf("Error in JWT token creation: %v\n", err)
-		jsonResponse(w, http.StatusUnauthorized, errorPayload{
-			Error: unauthorizedLoginErrorMessage,
-		})
+		log.Printf("Error in issuing tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	refreshToken, err := auth.MakeRefreshToken()
+	isChirpyRed, err := cfg.dbQueries.IsUserChirpyRed(r.Context(), requester.ID)
 	if err != nil {
-		log.Printf("Error when creating refresh token: %v\n", err)
-		jsonResponse(w, http.StatusUnauthorized, errorPayload{
-			Error: unauthorizedLoginErrorMessage,
-		})
+		log.Printf("Error in getting user's subscription: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if _, err = cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+
+	jsonResponse(w, http.StatusOK, responsePayload{
+		user:         newUser(cfg, requester, isChirpyRed),
+		Token:        token,
+		RefreshToken: refreshToken,
+	})
+}
+
+// twoFactorChallengePayload is what a login gets instead of tokens when the
+// user has two-factor authentication enabled.
+type twoFactorChallengePayload struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+// twoFactorChallenge returns the challenge of a login by userID, or nil if
+// the user has two-factor authentication disabled.
+func twoFactorChallenge(ctx context.Context, cfg *apiConfig, userID uuid.UUID) (*twoFactorChallengePayload, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !totp.EnabledAt.Valid {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("getting user's TOTP: %w", err)
+	}
+	challengeToken, err := auth.MakeChallengeJWT(userID, cfg.jwtKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactorChallengePayload{
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+	}, nil
+}
+
+// accessTokenExpiresIn is how long access tokens are valid for.
+const accessTokenExpiresIn = time.Hour
+
+// sessionTokens are the access and refresh tokens of a session.
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// sessionGrant is whom a session is granted to. The zero value is a login,
+// which is granted every scope.
+type sessionGrant struct {
+	ClientID sql.NullString
+	Scopes   []string
+}
+
+// issueTokens starts a new session for userID and returns its access and
+// refresh tokens.
+func issueTokens(cfg *apiConfig, r *http.Request, userID uuid.UUID) (string, string, error) {
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return "", "", fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, tokens, err := startSession(cfg, cfg.dbQueries.WithTx(tx), r, userID, sessionGrant{})
+	if err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("committing transaction: %w", err)
+	}
+	return tokens.AccessToken, tokens.RefreshToken, nil
+}
+
+// startSession starts a new session for userID, granted to grant.
+func startSession(
+	cfg *apiConfig,
+	q *database.Queries,
+	r *http.Request,
+	userID uuid.UUID,
+	grant sessionGrant,
+) (database.Session, sessionTokens, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.Session{}, sessionTokens{}, fmt.Errorf("creating refresh token: %w", err)
+	}
+
+	// The session's id doubles as the family of the refresh tokens it is
+	// rotated into on refresh.
+	session, err := q.CreateSession(r.Context(), database.CreateSessionParams{
+		ID:        uuid.New(),
+		UserID:    userID,
+		UserAgent: r.UserAgent(),
+		IpAddress: remoteIP(r),
+		ClientID:  grant.ClientID,
+		Scopes:    grant.Scopes,
+	})
+	if err != nil {
+		return database.Session{}, sessionTokens{}, fmt.Errorf("storing session: %w", err)
+	}
+	if _, err = q.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 		Token: refreshToken,
 		UserID: uuid.NullUUID{
-			UUID:  requester.ID,
+			UUID:  userID,
 			Valid: true,
 		},
+		FamilyID: session.ID,
 	}); err != nil {
-		log.Printf("Error when storing refresh token in database: %v\n", err)
-		jsonResponse(w, http.StatusUnauthorized, errorPayload{
-			Error: unauthorizedLoginErrorMessage,
-		})
-		return
+		return database.Session{}, sessionTokens{}, fmt.Errorf("storing refresh token: %w", err)
 	}
 
-	jsonResponse(w, http.StatusOK, responsePayload{
-		user: user{
-			ID:          requester.ID,
-			CreatedAt:   requester.CreatedAt.Time,
-			UpdatedAt:   requester.UpdatedAt.Time,
-			Email:       requester.Email.String,
-			IsChirpyRed: requester.IsChirpyRed.Bool,
-		},
-		Token:        token,
+	token, err := makeSessionJWT(cfg, session)
+	if err != nil {
+		return database.Session{}, sessionTokens{}, fmt.Errorf("creating JWT token: %w", err)
+	}
+	return session, sessionTokens{
+		AccessToken:  token,
 		RefreshToken: refreshToken,
-	})
+	}, nil
 }
 
+// makeSessionJWT returns an access token for session, granted what the
+// session is.
+func makeSessionJWT(cfg *apiConfig, session database.Session) (string, error) {
+	if session.ClientID.Valid {
+		return auth.MakeClientJWT(
+			session.UserID,
+			cfg.jwtKeys,
+			accessTokenExpiresIn,
+			session.ClientID.String,
+			session.Scopes,
+		)
+	}
+	return auth.MakeJWT(session.UserID, cfg.jwtKeys, accessTokenExpiresIn)
+}
+
+var (
+	errRefreshTokenInvalid = errors.New("refresh token is invalid, revoked or expired")
+	errRefreshTokenReused  = errors.New("rotated refresh token is reused")
+)
+
 func refreshHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 	type responsePayload struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	headerRefreshToken, err := auth.GetBearerToken(r.Header)
@@ -121,29 +269,128 @@ func refreshHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	refreshToken, err := cfg.dbQueries.GetRefreshToken(r.Context(), headerRefreshToken)
-	if err != nil {
-		log.Printf("Erron in getting refresh token from database: %v\n", err)
-		jsonResponse(w, http.StatusUnauthorized, errorPayload{
-			Error: "Unauthorized",
-		})
-		return
-	}
 
-	token, err := auth.MakeJWT(refreshToken.UserID.UUID, cfg.tokenSecret, time.Hour)
-	if err != nil {
-		log.Printf("Erron in creating JWT token: %v\n", err)
+	// Sessions of OAuth clients are refreshed at the token endpoint, where
+	// the client authenticates.
+	tokens, err := refreshSession(cfg, r, headerRefreshToken, sql.NullString{})
+	if errors.Is(err, errRefreshTokenInvalid) || errors.Is(err, errRefreshTokenReused) {
+		log.Printf("Error in refreshing session: %v\n", err)
 		jsonResponse(w, http.StatusUnauthorized, errorPayload{
 			Error: "Unauthorized",
 		})
 		return
+	} else if err != nil {
+		log.Printf("Error in refreshing session: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	jsonResponse(w, http.StatusOK, responsePayload{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	})
 }
 
+// refreshSession rotates refreshToken, of a session granted to clientID,
+// and returns the session's new tokens.
+func refreshSession(
+	cfg *apiConfig,
+	r *http.Request,
+	presentedToken string,
+	clientID sql.NullString,
+) (sessionTokens, error) {
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return sessionTokens{}, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// The row is locked so that concurrent refreshes with the same token
+	// cannot both rotate it.
+	refreshToken, err := qtx.GetRefreshTokenForUpdate(r.Context(), presentedToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sessionTokens{}, errRefreshTokenInvalid
+	} else if err != nil {
+		return sessionTokens{}, fmt.Errorf("getting refresh token: %w", err)
+	}
+	session, err := qtx.GetSession(r.Context(), refreshToken.FamilyID)
+	if err != nil {
+		return sessionTokens{}, fmt.Errorf("getting session: %w", err)
+	}
+	if session.ClientID != clientID {
+		return sessionTokens{}, errRefreshTokenInvalid
+	}
+
+	if refreshToken.RotatedAt.Valid {
+		// A rotated token is only ever presented again if it was stolen,
+		// either by whoever presents it now or by whoever rotated it
+		// before. As there is no telling which, the whole family is
+		// revoked.
+		revoked, err := qtx.RevokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID)
+		if err == nil {
+			_, err = qtx.RevokeSession(r.Context(), database.RevokeSessionParams{
+				ID:     refreshToken.FamilyID,
+				UserID: refreshToken.UserID.UUID,
+			})
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			return sessionTokens{}, fmt.Errorf("revoking refresh token family: %w", err)
+		}
+		log.Printf(
+			"SECURITY: reuse of rotated refresh token detected: user %v, family %v, %d tokens revoked, remote %v\n",
+			refreshToken.UserID.UUID,
+			refreshToken.FamilyID,
+			revoked,
+			r.RemoteAddr,
+		)
+		return sessionTokens{}, errRefreshTokenReused
+	}
+	// Expiry is left to the database, whose clock the expiry was set by.
+	if _, err := qtx.GetRefreshToken(r.Context(), refreshToken.Token); errors.Is(err, sql.ErrNoRows) {
+		return sessionTokens{}, errRefreshTokenInvalid
+	} else if err != nil {
+		return sessionTokens{}, fmt.Errorf("getting refresh token: %w", err)
+	}
+
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return sessionTokens{}, fmt.Errorf("creating refresh token: %w", err)
+	}
+	if err := qtx.RotateRefreshToken(r.Context(), refreshToken.Token); err != nil {
+		return sessionTokens{}, fmt.Errorf("rotating refresh token: %w", err)
+	}
+	if _, err := qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:    newRefreshToken,
+		UserID:   refreshToken.UserID,
+		FamilyID: refreshToken.FamilyID,
+	}); err != nil {
+		return sessionTokens{}, fmt.Errorf("storing refresh token: %w", err)
+	}
+	if err := qtx.TouchSession(r.Context(), database.TouchSessionParams{
+		ID:        refreshToken.FamilyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: remoteIP(r),
+	}); err != nil {
+		return sessionTokens{}, fmt.Errorf("updating session: %w", err)
+	}
+
+	token, err := makeSessionJWT(cfg, session)
+	if err != nil {
+		return sessionTokens{}, fmt.Errorf("creating JWT token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return sessionTokens{}, fmt.Errorf("committing transaction: %w", err)
+	}
+	return sessionTokens{
+		AccessToken:  token,
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
 func revokeHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 	authRefreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// loginFailureWindow is how long failed logins are remembered for,
+	// counted from the last one.
+	loginFailureWindow = time.Hour
+	// accountFreeFailures and ipFreeFailures are how many failed logins
+	// are let through before lockouts start. IPs get more, as many users
+	// may share one.
+	accountFreeFailures = 5
+	ipFreeFailures      = 20
+	// Lockouts start at minLoginLockout and double with every failure,
+	// up to maxLoginLockout.
+	minLoginLockout = time.Second
+	maxLoginLockout = 15 * time.Minute
+	// passwordResetFreeRequests and ipPasswordResetFreeRequests are how
+	// many password resets can be asked for before lockouts start, so that
+	// no one's inbox can be flooded with them. The same goes for email
+	// verifications.
+	passwordResetFreeRequests       = 3
+	ipPasswordResetFreeRequests     = 10
+	emailVerificationFreeRequests   = 3
+	ipEmailVerificationFreeRequests = 10
+)
+
+const tooManyLoginAttemptsMessage = "Too many login attempts, try again later"
+
+// loginThrottle is a key failed logins are counted under, along with how
+// many failures it lets through before locking out.
+type loginThrottle struct {
+	key          string
+	freeFailures int32
+}
+
+// accountLoginThrottle counts failed logins against email. It does not
+// matter whether an account with it exists, so that lockouts do not give
+// that away.
+func accountLoginThrottle(email string) loginThrottle {
+	return loginThrottle{
+		key:          "account:" + strings.ToLower(strings.TrimSpace(email)),
+		freeFailures: accountFreeFailures,
+	}
+}
+
+// twoFactorLoginThrottle counts failed second steps of a login. A
+// challenge token gives many tries at the second factor otherwise.
+func twoFactorLoginThrottle(userID uuid.UUID) loginThrottle {
+	return loginThrottle{
+		key:          "2fa:" + userID.String(),
+		freeFailures: accountFreeFailures,
+	}
+}
+
+func ipLoginThrottle(r *http.Request) loginThrottle {
+	return loginThrottle{
+		key:          "ip:" + remoteIP(r),
+		freeFailures: ipFreeFailures,
+	}
+}
+
+// passwordResetThrottle counts requests for password resets of email, as
+// accountLoginThrottle does failed logins.
+func passwordResetThrottle(email string) loginThrottle {
+	return loginThrottle{
+		key:          "reset:" + strings.ToLower(strings.TrimSpace(email)),
+		freeFailures: passwordResetFreeRequests,
+	}
+}
+
+func ipPasswordResetThrottle(r *http.Request) loginThrottle {
+	return loginThrottle{
+		key:          "reset-ip:" + remoteIP(r),
+		freeFailures: ipPasswordResetFreeRequests,
+	}
+}
+
+// emailVerificationThrottle counts the verification emails a user has
+// sent, whether asked for or sent on changing their email.
+func emailVerificationThrottle(userID uuid.UUID) loginThrottle {
+	return loginThrottle{
+		key:          "verify:" + userID.String(),
+		freeFailures: emailVerificationFreeRequests,
+	}
+}
+
+func ipEmailVerificationThrottle(r *http.Request) loginThrottle {
+	return loginThrottle{
+		key:          "verify-ip:" + remoteIP(r),
+		freeFailures: ipEmailVerificationFreeRequests,
+	}
+}
+
+// countThrottledRequest counts a request that sends email against
+// throttles, unless one of them locks it out, in which case it returns how
+// long until it does not.
+func countThrottledRequest(ctx context.Context, cfg *apiConfig, throttles ...loginThrottle) (time.Duration, error) {
+	retryAfter, err := loginLockout(ctx, cfg, throttles...)
+	if err != nil || retryAfter > 0 {
+		return retryAfter, err
+	}
+	return 0, recordLoginFailure(ctx, cfg, throttles...)
+}
+
+// writeRequestLockout responds to a request countThrottledRequest locked
+// out.
+func writeRequestLockout(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+	jsonResponse(w, http.StatusTooManyRequests, errorPayload{
+		Error: message,
+	})
+}
+
+// loginLockout returns how long until none of throttles is locked out, or
+// zero if none is.
+func loginLockout(ctx context.Context, cfg *apiConfig, throttles ...loginThrottle) (time.Duration, error) {
+	keys := make([]string, 0, len(throttles))
+	for _, throttle := range throttles {
+		keys = append(keys, throttle.key)
+	}
+	seconds, err := cfg.dbQueries.GetLoginLockout(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// recordLoginFailure counts a failed login against each of throttles,
+// locking out those that have run out of free failures.
+func recordLoginFailure(ctx context.Context, cfg *apiConfig, throttles ...loginThrottle) error {
+	for _, throttle := range throttles {
+		failures, err := cfg.dbQueries.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Key:           throttle.key,
+			WindowSeconds: loginFailureWindow.Seconds(),
+		})
+		if err != nil {
+			return err
+		}
+		if failures <= throttle.freeFailures {
+			continue
+		}
+		// The shift is capped well before it could overflow.
+		doublings := min(failures-throttle.freeFailures-1, 30)
+		lockout := min(minLoginLockout<<doublings, maxLoginLockout)
+		if err := cfg.dbQueries.LockLogin(ctx, database.LockLoginParams{
+			LockoutSeconds: lockout.Seconds(),
+			Key:            throttle.key,
+		}); err != nil {
+			return err
+		}
+		log.Printf("SECURITY: login locked out: %v, %d failures, for %v\n", throttle.key, failures, lockout)
+	}
+	return nil
+}
+
+// clearLoginFailures forgets the failed logins counted against throttle.
+func clearLoginFailures(ctx context.Context, cfg *apiConfig, throttle loginThrottle) (bool, error) {
+	deleted, err := cfg.dbQueries.DeleteLoginThrottle(ctx, throttle.key)
+	return deleted > 0, err
+}
+
+// writeLoginLockout responds to a login that is locked out. The response is
+// the same whichever throttle locked it out.
+func writeLoginLockout(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+	jsonResponse(w, http.StatusTooManyRequests, errorPayload{
+		Error: tooManyLoginAttemptsMessage,
+	})
+}
+
+// unlockLoginHandler lets an admin lift the lockout of an account or of an
+// IP before it runs out.
+func unlockLoginHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+	type responsePayload struct {
+		Unlocked bool `json:"unlocked"`
+	}
+
+	if err := authenticateAdmin(cfg, r); err != nil {
+		log.Printf("POST admin unlock login: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST admin unlock login: error in parsing request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var throttles []loginThrottle
+	if len(request.Email) > 0 {
+		throttles = append(throttles, accountLoginThrottle(request.Email))
+		requester, err := cfg.dbQueries.GetUser(r.Context(), sql.NullString{
+			Valid:  true,
+			String: request.Email,
+		})
+		if err == nil {
+			throttles = append(throttles, twoFactorLoginThrottle(requester.ID))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("POST admin unlock login: error in finding user: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(request.IP) > 0 {
+		throttles = append(throttles, loginThrottle{key: "ip:" + request.IP})
+	}
+	if len(throttles) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Either email or ip is required",
+		})
+		return
+	}
+
+	response := responsePayload{}
+	for _, throttle := range throttles {
+		cleared, err := clearLoginFailures(r.Context(), cfg, throttle)
+		if err != nil {
+			log.Printf("POST admin unlock login: error in clearing login failures: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		response.Unlocked = response.Unlocked || cleared
+	}
+	log.Printf("SECURITY: login unlocked by admin: email %q, ip %q\n", request.Email, request.IP)
+
+	jsonResponse(w, http.StatusOK, response)
+}
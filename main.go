@@ -1,13 +1,22 @@
 package main
 
 import (
+	"ValenTheRed/chirpy/internal/auth"
 	"ValenTheRed/chirpy/internal/database"
+	"ValenTheRed/chirpy/internal/mail"
+	"ValenTheRed/chirpy/internal/oidc"
+	"ValenTheRed/chirpy/internal/storage"
+	"context"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -15,9 +24,37 @@ import (
 
 type apiConfig struct {
 	requestsCount atomic.Int64
+	db            *sql.DB
 	dbQueries     *database.Queries
-	tokenSecret   string
+	jwtKeys       *auth.KeyRing
 	polkaApiKey   string
+	adminApiKey   string
+	// trendingWindow is how far back trending hashtags look by default.
+	trendingWindow time.Duration
+	mediaStore     storage.Store
+	// totpSecrets encrypts TOTP secrets at rest. It is nil when two-factor
+	// authentication is not configured.
+	totpSecrets *auth.SecretBox
+	mailer      mail.Mailer
+	// publicURL is where the server is reached from outside, for links in
+	// emails.
+	publicURL string
+	// passwordParams are what new password hashes are made with. Weaker
+	// hashes are upgraded on login.
+	passwordParams *auth.PasswordParams
+	// oidcProvider is the OpenID Connect provider users may sign in with.
+	// It is nil when none is configured.
+	oidcProvider *oidc.Provider
+	// polkaWebhookSecret verifies the signatures of Polka webhooks. It is
+	// only empty in development, where polkaApiKey authenticates them
+	// instead.
+	polkaWebhookSecret string
+	// freeLimits are the chirpLimits of users who are not Chirpy Red, and
+	// redLimits of those who are.
+	freeLimits chirpLimits
+	redLimits  chirpLimits
+	// chirpStream sends chirp events to the streams open on this server.
+	chirpStream *chirpStream
 }
 
 func (cfg *apiConfig) increaseRequestsCount(handler http.Handler) http.Handler {
@@ -57,11 +94,162 @@ func main() {
 		log.Fatalf("could not connect to db at %v\n", dbUrl)
 	}
 
+	trendingWindow := defaultTrendingWindow
+	if s := os.Getenv("TRENDING_WINDOW"); len(s) > 0 {
+		trendingWindow, err = time.ParseDuration(s)
+		if err != nil {
+			log.Fatalf("TRENDING_WINDOW is not a duration: %v\n", err)
+		}
+	}
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if len(mediaDir) == 0 {
+		mediaDir = "media"
+	}
+	mediaStore, err := storage.NewLocal(mediaDir, "/media")
+	if err != nil {
+		log.Fatalf("could not create media store at %v: %v\n", mediaDir, err)
+	}
+
+	var jwtKeys *auth.KeyRing
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); len(keysDir) > 0 {
+		jwtKeys, err = auth.LoadKeyRing(keysDir, os.Getenv("JWT_SIGNING_KID"))
+	} else if os.Getenv("PLATFORM") == "DEV" {
+		log.Printf("JWT_KEYS_DIR is not set, signing JWTs with a throwaway key\n")
+		jwtKeys, err = auth.GenerateKeyRing()
+	} else {
+		// A throwaway key would sign tokens no other instance accepts, and
+		// that this one forgets on restart.
+		log.Fatalf("JWT_KEYS_DIR is not set\n")
+	}
+	if err != nil {
+		log.Fatalf("could not load JWT keys: %v\n", err)
+	}
+	// HS256 tokens signed with TOKEN_SECRET are accepted until
+	// TOKEN_SECRET_UNTIL, by when they have expired.
+	if tokenSecret := os.Getenv("TOKEN_SECRET"); len(tokenSecret) > 0 {
+		until, err := time.Parse(time.RFC3339, os.Getenv("TOKEN_SECRET_UNTIL"))
+		if err != nil {
+			log.Fatalf("TOKEN_SECRET_UNTIL is not an RFC 3339 time: %v\n", err)
+		}
+		jwtKeys.AcceptLegacySecret(tokenSecret, until)
+	}
+
+	// The parameters are copied, so that the defaults of the argon2id
+	// package are left as they are.
+	passwordParams := *auth.DefaultPasswordParams
+	for name, param := range map[string]*uint32{
+		"PASSWORD_HASH_MEMORY_KIB": &passwordParams.Memory,
+		"PASSWORD_HASH_ITERATIONS": &passwordParams.Iterations,
+	} {
+		if s := os.Getenv(name); len(s) > 0 {
+			n, err := strconv.ParseUint(s, 10, 32)
+			if err != nil || n == 0 {
+				log.Fatalf("%v is not a positive integer: %v\n", name, s)
+			}
+			*param = uint32(n)
+		}
+	}
+	if s := os.Getenv("PASSWORD_HASH_PARALLELISM"); len(s) > 0 {
+		n, err := strconv.ParseUint(s, 10, 8)
+		if err != nil || n == 0 {
+			log.Fatalf("PASSWORD_HASH_PARALLELISM is not a positive integer: %v\n", s)
+		}
+		passwordParams.Parallelism = uint8(n)
+	}
+
+	freeLimits, err := loadChirpLimits("", defaultFreeLimits)
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	redLimits, err := loadChirpLimits("RED_", defaultRedLimits)
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
+
+	var totpSecrets *auth.SecretBox
+	if s := os.Getenv("TOTP_ENCRYPTION_KEY"); len(s) > 0 {
+		key, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			log.Fatalf("TOTP_ENCRYPTION_KEY is not base64: %v\n", err)
+		}
+		totpSecrets, err = auth.NewSecretBox(key)
+		if err != nil {
+			log.Fatalf("TOTP_ENCRYPTION_KEY is invalid: %v\n", err)
+		}
+	}
+
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if len(publicURL) == 0 {
+		publicURL = "http://localhost:8080"
+	}
+	// Tokens, introspection and the OAuth metadata all name the server by
+	// its public URL.
+	jwtKeys.SetIssuer(publicURL)
+	mailFrom := os.Getenv("MAIL_FROM")
+	if len(mailFrom) == 0 {
+		mailFrom = "Chirpy <no-reply@localhost>"
+	}
+	var mailer mail.Mailer
+	if smtpAddr := os.Getenv("SMTP_ADDR"); len(smtpAddr) > 0 {
+		mailer, err = mail.NewSMTP(
+			smtpAddr,
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			mailFrom,
+		)
+		if err != nil {
+			log.Fatalf("could not set up SMTP at %v: %v\n", smtpAddr, err)
+		}
+	} else {
+		mailer = mail.NewLog(os.Stderr, mailFrom)
+	}
+
+	var oidcProvider *oidc.Provider
+	if issuer := os.Getenv("OIDC_ISSUER"); len(issuer) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		oidcProvider, err = oidc.Discover(ctx, oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  publicURL + "/api/login/oidc/callback",
+			Scopes:       []string{"email", "profile"},
+		}, &http.Client{Timeout: 10 * time.Second})
+		cancel()
+		if err != nil {
+			log.Fatalf("could not set up OIDC provider: %v\n", err)
+		}
+	}
+
+	polkaWebhookSecret := os.Getenv("POLKA_WEBHOOK_SECRET")
+	if len(polkaWebhookSecret) == 0 {
+		if os.Getenv("PLATFORM") != "DEV" {
+			// The static API key is sent as is with every webhook, and
+			// does not stop a captured one from being replayed.
+			log.Fatalf("POLKA_WEBHOOK_SECRET is not set\n")
+		}
+		log.Printf("POLKA_WEBHOOK_SECRET is not set, authenticating Polka webhooks with POLKA_KEY\n")
+	}
+
 	cfg := apiConfig{
+		db:          db,
 		dbQueries:   database.New(db),
-		tokenSecret: os.Getenv("TOKEN_SECRET"),
+		jwtKeys:     jwtKeys,
 		polkaApiKey: os.Getenv("POLKA_KEY"),
+		adminApiKey: os.Getenv("ADMIN_API_KEY"),
+
+		trendingWindow:     trendingWindow,
+		mediaStore:         mediaStore,
+		totpSecrets:        totpSecrets,
+		mailer:             mailer,
+		publicURL:          publicURL,
+		passwordParams:     &passwordParams,
+		oidcProvider:       oidcProvider,
+		polkaWebhookSecret: polkaWebhookSecret,
+		freeLimits:         freeLimits,
+		redLimits:          redLimits,
 	}
+	cfg.chirpStream = newChirpStream(&cfg)
 	root := os.DirFS(".")
 
 	mux := http.NewServeMux()
@@ -69,6 +257,10 @@ func main() {
 		"/app/",
 		cfg.increaseRequestsCount(http.StripPrefix("/app", http.FileServerFS(root))),
 	)
+	mediaFS := os.DirFS(mediaStore.Dir())
+	mux.HandleFunc("GET /media/{key}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, mediaFS, r.PathValue("key"))
+	})
 	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
@@ -76,21 +268,90 @@ func main() {
 	})
 	mux.HandleFunc("GET /admin/metrics", cfg.logRequestsCount)
 	mux.HandleFunc("POST /admin/reset", enableOnDevEnv(cfg.resetRequestsCount))
+	mux.HandleFunc("POST /admin/login-lockouts/unlock", withApiConfig(&cfg, unlockLoginHandler))
+	mux.HandleFunc("GET /admin/password-hashes", withApiConfig(&cfg, passwordHashesReportHandler))
+	mux.HandleFunc("GET /admin/webhook-events", withApiConfig(&cfg, listWebhookEventsHandler))
+	mux.HandleFunc("GET /admin/webhook-events/{eventID}", withApiConfig(&cfg, getWebhookEventHandler))
+	mux.HandleFunc("POST /admin/webhook-events/{eventID}/replay", withApiConfig(&cfg, replayWebhookEventHandler))
+
+	mux.HandleFunc("GET /.well-known/jwks.json", withApiConfig(&cfg, jwksHandler))
+	mux.HandleFunc("GET /.well-known/oauth-authorization-server", withApiConfig(&cfg, oauthMetadataHandler))
 
 	mux.HandleFunc("POST /api/login", withApiConfig(&cfg, loginHandler))
+	mux.HandleFunc("POST /api/login/2fa", withApiConfig(&cfg, loginTwoFactorHandler))
+	mux.HandleFunc("GET /api/login/oidc", withApiConfig(&cfg, oidcLoginHandler))
+	mux.HandleFunc("GET /api/login/oidc/callback", withApiConfig(&cfg, oidcCallbackHandler))
+	mux.HandleFunc("POST /api/password-reset/request", withApiConfig(&cfg, requestPasswordResetHandler))
+	mux.HandleFunc("POST /api/password-reset/confirm", withApiConfig(&cfg, confirmPasswordResetHandler))
+	mux.HandleFunc("POST /api/email-verification/request", withApiConfig(&cfg, requestEmailVerificationHandler))
+	mux.HandleFunc("POST /api/email-verification/confirm", withApiConfig(&cfg, confirmEmailVerificationHandler))
 	mux.HandleFunc("POST /api/refresh", withApiConfig(&cfg, refreshHandler))
 	mux.HandleFunc("POST /api/revoke", withApiConfig(&cfg, revokeHandler))
+	mux.HandleFunc("GET /api/sessions", withApiConfig(&cfg, listSessionsHandler))
+	mux.HandleFunc("POST /api/sessions/revoke-all", withApiConfig(&cfg, revokeAllSessionsHandler))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", withApiConfig(&cfg, revokeSessionHandler))
+
+	mux.HandleFunc("POST /api/tokens", withApiConfig(&cfg, createAccessTokenHandler))
+	mux.HandleFunc("GET /api/tokens", withApiConfig(&cfg, listAccessTokensHandler))
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", withApiConfig(&cfg, revokeAccessTokenHandler))
+
+	mux.HandleFunc("POST /api/oauth/clients", withApiConfig(&cfg, createOAuthClientHandler))
+	mux.HandleFunc("GET /api/oauth/clients", withApiConfig(&cfg, listOAuthClientsHandler))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", withApiConfig(&cfg, deleteOAuthClientHandler))
+
+	mux.HandleFunc("GET /oauth/authorize", withApiConfig(&cfg, authorizeHandler))
+	mux.HandleFunc("POST /oauth/authorize", withApiConfig(&cfg, approveAuthorizationHandler))
+	mux.HandleFunc("POST /oauth/token", withApiConfig(&cfg, tokenHandler))
+	mux.HandleFunc("POST /oauth/revoke", withApiConfig(&cfg, oauthRevokeHandler))
+	mux.HandleFunc("POST /oauth/introspect", withApiConfig(&cfg, introspectHandler))
 
 	mux.HandleFunc("POST /api/users", withApiConfig(&cfg, usersHandler))
 	mux.HandleFunc("PUT /api/users", withApiConfig(&cfg, updateUsersHandler))
+	mux.HandleFunc("PATCH /api/users/me", withApiConfig(&cfg, updateProfileHandler))
+	mux.HandleFunc("POST /api/users/me/2fa/enroll", withApiConfig(&cfg, enrollTwoFactorHandler))
+	mux.HandleFunc("POST /api/users/me/2fa/confirm", withApiConfig(&cfg, confirmTwoFactorHandler))
+	mux.HandleFunc("DELETE /api/users/me/2fa", withApiConfig(&cfg, disableTwoFactorHandler))
+	mux.HandleFunc("GET /api/users/me/identities", withApiConfig(&cfg, listIdentitiesHandler))
+	mux.HandleFunc("DELETE /api/users/me/identities/{identityID}", withApiConfig(&cfg, unlinkIdentityHandler))
+	mux.HandleFunc("GET /api/users/me/mentions", withApiConfig(&cfg, listMentionsHandler))
+	mux.HandleFunc("GET /api/users/{handle}", withApiConfig(&cfg, getProfileHandler))
+	mux.HandleFunc("POST /api/users/{userID}/follow", withApiConfig(&cfg, followUserHandler))
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", withApiConfig(&cfg, unfollowUserHandler))
+	mux.HandleFunc("GET /api/users/{userID}/followers", withApiConfig(&cfg, listFollowersHandler))
+	mux.HandleFunc("GET /api/users/{userID}/following", withApiConfig(&cfg, listFollowingHandler))
+
+	mux.HandleFunc("GET /api/timeline", withApiConfig(&cfg, timelineHandler))
+
+	mux.HandleFunc("GET /api/hashtags/trending", withApiConfig(&cfg, trendingHashtagsHandler))
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", withApiConfig(&cfg, listHashtagChirpsHandler))
 
 	mux.HandleFunc("POST /api/chirps", withApiConfig(&cfg, createChirpsHandler))
 	mux.HandleFunc("GET /api/chirps", withApiConfig(&cfg, listChirpsHandler))
+	mux.HandleFunc("GET /api/stream/chirps", withApiConfig(&cfg, streamChirpsHandler))
+	mux.HandleFunc("GET /api/chirps/search", withApiConfig(&cfg, searchChirpsHandler))
 	mux.HandleFunc("GET /api/chirps/{chirpID}", withApiConfig(&cfg, getChirpHandler))
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", withApiConfig(&cfg, updateChirpHandler))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", withApiConfig(&cfg, listChirpRevisionsHandler))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", withApiConfig(&cfg, getChirpThreadHandler))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/likes", withApiConfig(&cfg, listChirpLikesHandler))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/likes", withApiConfig(&cfg, likeChirpHandler))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/likes", withApiConfig(&cfg, unlikeChirpHandler))
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", withApiConfig(&cfg, deleteChirpHandler))
 
+	mux.HandleFunc("POST /api/media", withApiConfig(&cfg, uploadMediaHandler))
+
 	mux.HandleFunc("POST /api/polka/webhooks", withApiConfig(&cfg, polkaWebHooksHandler))
 
+	mux.HandleFunc("POST /api/webhooks", withApiConfig(&cfg, createWebhookEndpointHandler))
+	mux.HandleFunc("GET /api/webhooks", withApiConfig(&cfg, listWebhookEndpointsHandler))
+	mux.HandleFunc("DELETE /api/webhooks/{endpointID}", withApiConfig(&cfg, deleteWebhookEndpointHandler))
+	mux.HandleFunc("POST /api/webhooks/{endpointID}/enable", withApiConfig(&cfg, enableWebhookEndpointHandler))
+	mux.HandleFunc("GET /api/webhooks/{endpointID}/attempts", withApiConfig(&cfg, listWebhookDeliveryAttemptsHandler))
+
+	go expireSubscriptionsPeriodically(&cfg, subscriptionExpiryInterval)
+	go newWebhookDispatcher(&cfg).run(webhookDispatchInterval)
+	go cfg.chirpStream.listen(dbUrl)
+
 	server := http.Server{
 		Addr:    ":8080",
 		Handler: mux,
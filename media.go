@@ -0,0 +1,202 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxMediaSize    = 5 << 20
+	maxAltTextRunes = 1000
+	// maxImageDimension and maxImagePixels bound the size of an image once
+	// decoded, which a small, well compressed file can make huge.
+	maxImageDimension = 8192
+	maxImagePixels    = 40_000_000
+)
+
+// mediaExtensions are the accepted content types, as sniffed from the
+// upload, along with the file extension they are stored with.
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+var (
+	errUnsupportedMedia = errors.New("media type is not supported")
+	errImageTooLarge    = errors.New("image is too large")
+)
+
+// reencodeImage decodes an image and encodes it again in the same format.
+// Only the pixels survive, so metadata such as EXIF, which can carry the
+// location a photo was taken at, is stripped. The image's dimensions are
+// checked before it is decoded.
+func reencodeImage(content []byte, contentType string) ([]byte, image.Config, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, image.Config{}, fmt.Errorf("error in decoding image config: %w", err)
+	}
+	if config.Width > maxImageDimension || config.Height > maxImageDimension ||
+		config.Width*config.Height > maxImagePixels {
+		return nil, image.Config{}, fmt.Errorf("%w: %dx%d", errImageTooLarge, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, image.Config{}, fmt.Errorf("error in decoding image: %w", err)
+	}
+	var out bytes.Buffer
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+	case "image/png":
+		err = png.Encode(&out, img)
+	default:
+		err = errUnsupportedMedia
+	}
+	if err != nil {
+		return nil, image.Config{}, err
+	}
+	bounds := img.Bounds()
+	return out.Bytes(), image.Config{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}, nil
+}
+
+func uploadMediaHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload media
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST media: error in getting token from authorization: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Unauthorized",
+		})
+		return
+	}
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsWrite)
+	if err != nil {
+		log.Printf("POST media: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeChirpsWrite)
+		return
+	}
+
+	// Some room is left over maxMediaSize for the rest of the form.
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize+(64<<10))
+	if err := r.ParseMultipartForm(maxMediaSize); err != nil {
+		log.Printf("POST media: error in parsing form: %v\n", err)
+		if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+			jsonResponse(w, http.StatusRequestEntityTooLarge, errorPayload{
+				Error: "Media is too large",
+			})
+			return
+		}
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid multipart form",
+		})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("POST media: error in reading file: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Missing file",
+		})
+		return
+	}
+	defer file.Close()
+	altText := r.FormValue("alt_text")
+	if utf8.RuneCountInString(altText) > maxAltTextRunes {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Alt text is too long",
+		})
+		return
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, maxMediaSize+1))
+	if err != nil {
+		log.Printf("POST media: error in reading file: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(content) > maxMediaSize {
+		jsonResponse(w, http.StatusRequestEntityTooLarge, errorPayload{
+			Error: "Media is too large",
+		})
+		return
+	}
+	// The content type the client claims is not trusted.
+	contentType := http.DetectContentType(content)
+	extension, ok := mediaExtensions[contentType]
+	if !ok {
+		jsonResponse(w, http.StatusUnsupportedMediaType, errorPayload{
+			Error: "Media type is not supported",
+		})
+		return
+	}
+	stripped, config, err := reencodeImage(content, contentType)
+	if errors.Is(err, errImageTooLarge) {
+		log.Printf("POST media: %v\n", err)
+		jsonResponse(w, http.StatusRequestEntityTooLarge, errorPayload{
+			Error: fmt.Sprintf("Images can be up to %d pixels on a side and %d pixels in all", maxImageDimension, maxImagePixels),
+		})
+		return
+	} else if err != nil {
+		log.Printf("POST media: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Media is not a valid image",
+		})
+		return
+	}
+
+	mediaID := uuid.New()
+	key := mediaID.String() + extension
+	if err := cfg.mediaStore.Put(r.Context(), key, bytes.NewReader(stripped)); err != nil {
+		log.Printf("POST media: error in storing media: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	stored, err := cfg.dbQueries.CreateMedia(r.Context(), database.CreateMediaParams{
+		ID:          mediaID,
+		UserID:      userID,
+		StorageKey:  key,
+		ContentType: contentType,
+		SizeBytes:   int64(len(stripped)),
+		Width:       int32(config.Width),
+		Height:      int32(config.Height),
+		AltText:     altText,
+	})
+	if err != nil {
+		log.Printf("POST media: error in creating media: %v\n", err)
+		if err := cfg.mediaStore.Delete(r.Context(), key); err != nil {
+			log.Printf("POST media: error in removing orphaned media: %v\n", err)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, responsePayload(newMedia(cfg, stored)))
+}
+
+// newMedia converts media from the database into its API model.
+func newMedia(cfg *apiConfig, m database.Medium) media {
+	return media{
+		ID:          m.ID,
+		URL:         cfg.mediaStore.URL(m.StorageKey),
+		ContentType: m.ContentType,
+		Width:       m.Width,
+		Height:      m.Height,
+		AltText:     m.AltText,
+	}
+}
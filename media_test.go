@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// makePNG returns a PNG of a single pixel whose header claims it is width
+// by height pixels.
+func makePNG(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	content := buf.Bytes()
+	// The IHDR chunk follows the 8 byte signature: its length, type, data
+	// starting with the width and height, and a CRC of type and data.
+	ihdr := content[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	binary.BigEndian.PutUint32(content[8+8+13:], crc32.ChecksumIEEE(content[8+4:8+8+13]))
+	return content
+}
+
+func TestReencodeImage(t *testing.T) {
+	tests := []struct {
+		name    string // description of this test case
+		content []byte
+		wantErr error
+	}{
+		{
+			name:    "image is reencoded",
+			content: makePNG(t, 1, 1),
+			wantErr: nil,
+		},
+		{
+			name:    "image is too wide",
+			content: makePNG(t, maxImageDimension+1, 1),
+			wantErr: errImageTooLarge,
+		},
+		{
+			name:    "image has too many pixels",
+			content: makePNG(t, maxImageDimension, maxImageDimension),
+			wantErr: errImageTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, config, gotErr := reencodeImage(tt.content, "image/png")
+			if tt.wantErr != nil {
+				if !errors.Is(gotErr, tt.wantErr) {
+					t.Errorf("reencodeImage() error = %v, want %v", gotErr, tt.wantErr)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("reencodeImage() failed: %v", gotErr)
+			}
+			if config.Width != 1 || config.Height != 1 {
+				t.Errorf("reencodeImage() config = %+v, want 1x1", config)
+			}
+		})
+	}
+}
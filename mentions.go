@@ -0,0 +1,173 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// mentionPattern matches an `@` followed by a handle, when the `@` does
+// not continue a word, as in an email address.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])(@[A-Za-z0-9_]{3,30})`)
+
+// mentionSpan is a mention within a chirp's body. Start and End are byte
+// offsets of the `@` and of the end of the handle. UserID is set once the
+// handle is resolved.
+type mentionSpan struct {
+	Handle string
+	Start  int
+	End    int
+	UserID uuid.UUID
+}
+
+// findMentions returns the mentions of body in the order they appear.
+func findMentions(body string) []mentionSpan {
+	spans := []mentionSpan{}
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(body, -1) {
+		start, end := match[2], match[3]
+		// A handle is at most 30 characters long, so a longer run of
+		// handle characters is not a mention.
+		if end < len(body) && isHandleByte(body[end]) {
+			continue
+		}
+		spans = append(spans, mentionSpan{
+			Handle: body[start+1 : end],
+			Start:  start,
+			End:    end,
+		})
+	}
+	return spans
+}
+
+func isHandleByte(b byte) bool {
+	return b == '_' ||
+		('0' <= b && b <= '9') ||
+		('a' <= b && b <= 'z') ||
+		('A' <= b && b <= 'Z')
+}
+
+// resolveMentions looks up the users mentioned in body, by their
+// lowercased handles. Mentions of handles no one has are left out.
+func resolveMentions(ctx context.Context, q *database.Queries, body string) (map[string]uuid.UUID, error) {
+	spans := findMentions(body)
+	if len(spans) == 0 {
+		return map[string]uuid.UUID{}, nil
+	}
+
+	handles := make([]string, 0, len(spans))
+	for _, span := range spans {
+		handles = append(handles, strings.ToLower(span.Handle))
+	}
+	users, err := q.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		userIDs[strings.ToLower(user.Handle.String)] = user.ID
+	}
+	return userIDs, nil
+}
+
+// indexChirpMentions stores mentions, the resolved mentions of a chirp's
+// body as returned by cleanChirpBody. The body is not parsed again, as
+// masking it can make mentions that were not written. Offsets are stored in
+// characters, not bytes, as that is what clients index strings by.
+func indexChirpMentions(ctx context.Context, q *database.Queries, c database.Chirp, mentions []mentionSpan) error {
+	params := database.AddChirpMentionsParams{
+		ChirpID:   c.ID,
+		CreatedAt: c.CreatedAt.Time,
+	}
+	for _, span := range mentions {
+		params.UserIds = append(params.UserIds, span.UserID)
+		params.StartOffsets = append(
+			params.StartOffsets,
+			int32(utf8.RuneCountInString(c.Body.String[:span.Start])),
+		)
+		params.EndOffsets = append(
+			params.EndOffsets,
+			int32(utf8.RuneCountInString(c.Body.String[:span.End])),
+		)
+	}
+	if len(params.UserIds) == 0 {
+		return nil
+	}
+	return q.AddChirpMentions(ctx, params)
+}
+
+func listMentionsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload chirpsPage
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("GET mentions: error in getting token from authorization: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Unauthorized",
+		})
+		return
+	}
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsRead)
+	if err != nil {
+		log.Printf("GET mentions: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeChirpsRead)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET mentions: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	cursorCreatedAt, cursorID, err := parsePageCursor(query.Get("cursor"))
+	if err != nil {
+		log.Printf("GET mentions: error in decoding cursor: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid cursor",
+		})
+		return
+	}
+
+	// One extra row is fetched to know whether a next page exists.
+	chirps, err := cfg.dbQueries.GetMentionChirps(r.Context(), database.GetMentionChirpsParams{
+		UserID:          userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        limit + 1,
+	})
+	if err != nil {
+		log.Printf("GET mentions: error in retrieving chirps: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		response.NextCursor = pageCursor{
+			CreatedAt: last.CreatedAt.Time,
+			ID:        last.ID,
+		}.encode()
+	}
+	response.Chirps, err = chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, uuid.NullUUID{
+		UUID:  userID,
+		Valid: true,
+	}), chirps)
+	if err != nil {
+		log.Printf("GET mentions: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
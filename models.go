@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,18 +9,220 @@ import (
 
 // NOTE: follows the generated model database.Chirp
 type chirp struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Body       string     `json:"body"`
+	InReplyTo  *uuid.UUID `json:"in_reply_to"`
+	ReplyCount int64      `json:"reply_count"`
+	LikeCount  int64      `json:"like_count"`
+	// LikedByMe is only reported to an authenticated caller.
+	LikedByMe *bool `json:"liked_by_me,omitempty"`
+	// Author is only embedded when asked for with `?expand=author`.
+	Author   *chirpAuthor   `json:"author,omitempty"`
+	Mentions []chirpMention `json:"mentions"`
+	Media    []media        `json:"media"`
+}
+
+// chirpMention is a mention of a user within a chirp's body. Start and End
+// are offsets, in characters, of the `@` and of the end of the handle.
+type chirpMention struct {
+	UserID uuid.UUID `json:"user_id"`
+	Handle *string   `json:"handle"`
+	Start  int32     `json:"start"`
+	End    int32     `json:"end"`
+}
+
+// chirpAuthor is the compact profile of a chirp's author.
+type chirpAuthor struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      *string   `json:"handle"`
+	DisplayName string    `json:"display_name"`
 }
 
 // NOTE: follows the generated model database.User
 type user struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Email           string    `json:"email"`
+	IsEmailVerified bool      `json:"is_email_verified"`
+	IsChirpyRed     bool      `json:"is_chirpy_red"`
+	Handle          *string   `json:"handle"`
+	DisplayName     string    `json:"display_name"`
+	Bio             string    `json:"bio"`
+	Limits          limits    `json:"limits"`
+}
+
+// limits are what a user may do with their chirps, for clients to check
+// chirps against before sending them.
+type limits struct {
+	MaxChirpLength    int `json:"max_chirp_length"`
+	MaxChirpMedia     int `json:"max_chirp_media"`
+	EditWindowSeconds int `json:"edit_window_seconds"`
+	ChirpsPerHour     int `json:"chirps_per_hour"`
+}
+
+// profile is the public view of a user. Unlike user, it is shown to
+// anyone, so it leaves out the email.
+type profile struct {
 	ID          uuid.UUID `json:"id"`
 	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
+	Handle      *string   `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
 }
+
+// chirpsPage is one page of a keyset paginated list of chirps. NextCursor
+// is empty on the last page.
+type chirpsPage struct {
+	Chirps     []chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// chirpSearchResult is a chirp matched by a full-text search. Snippet is
+// the chirp's body as HTML, escaped, with the matched words enclosed in
+// <mark> tags.
+type chirpSearchResult struct {
+	chirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// NOTE: follows the generated model database.ChirpRevision. Body is the
+// chirp's body as it was before the edit made at CreatedAt.
+type chirpRevision struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Body      string    `json:"body"`
+}
+
+// chirpReply is a chirp within a thread. Depth is 1 for a direct reply to
+// the thread's chirp, 2 for a reply to that reply and so on.
+type chirpReply struct {
+	chirp
+	Depth int32 `json:"depth"`
+}
+
+// chirpThread is a chirp along with its conversation. Ancestors go from
+// the root of the conversation down to the chirp's parent. Replies are
+// ordered breadth first and are paginated.
+type chirpThread struct {
+	Ancestors  []chirp      `json:"ancestors"`
+	Chirp      chirp        `json:"chirp"`
+	Replies    []chirpReply `json:"replies"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// NOTE: follows the generated model database.ChirpLike
+type chirpLike struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// chirpLikesPage is one page of the likes of a chirp, newest first.
+// NextCursor is empty on the last page.
+type chirpLikesPage struct {
+	Likes      []chirpLike `json:"likes"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// follow is one side of a follow, that is, either the follower or the
+// followee, along with when the follow happened.
+type follow struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// followsPage is one page of a user's followers or following, newest
+// first. NextCursor is empty on the last page.
+type followsPage struct {
+	Follows    []follow `json:"follows"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// trendingHashtag is a tag ranked by its recent uses. Score weighs each
+// use by how recent it is.
+type trendingHashtag struct {
+	Tag   string  `json:"tag"`
+	Uses  int64   `json:"uses"`
+	Score float64 `json:"score"`
+}
+
+// NOTE: follows the generated model database.Medium
+type media struct {
+	ID          uuid.UUID `json:"id"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	Width       int32     `json:"width"`
+	Height      int32     `json:"height"`
+	AltText     string    `json:"alt_text"`
+}
+
+// NOTE: follows the generated model database.UserIdentity
+type identity struct {
+	ID          uuid.UUID `json:"id"`
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// NOTE: follows the generated model database.WebhookEvent
+type webhookEvent struct {
+	ID             uuid.UUID       `json:"id"`
+	Provider       string          `json:"provider"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	ReceivedAt     time.Time       `json:"received_at"`
+	LastReceivedAt time.Time       `json:"last_received_at"`
+	Deliveries     int32           `json:"deliveries"`
+	ProcessedAt    *time.Time      `json:"processed_at"`
+	Attempts       int32           `json:"attempts"`
+	LastError      *string         `json:"last_error"`
+}
+
+// webhookEventsPage is one page of received webhook events, newest first.
+// NextCursor is empty on the last page.
+type webhookEventsPage struct {
+	Events     []webhookEvent `json:"events"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// NOTE: follows the generated model database.WebhookEndpoint. The secret
+// is left out, as it is only shown when the endpoint is created.
+type webhookEndpoint struct {
+	ID                  uuid.UUID  `json:"id"`
+	URL                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+}
+
+// NOTE: follows the generated model database.WebhookDeliveryAttempt.
+// StatusCode is null when no response was received.
+type webhookDeliveryAttempt struct {
+	ID          uuid.UUID `json:"id"`
+	DeliveryID  uuid.UUID `json:"delivery_id"`
+	EventID     uuid.UUID `json:"event_id"`
+	EventType   string    `json:"event_type"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  *int32    `json:"status_code"`
+	Error       *string   `json:"error"`
+	DurationMs  int32     `json:"duration_ms"`
+}
+
+// webhookDeliveryAttemptsPage is one page of the attempts at delivering
+// to a webhook endpoint, newest first. NextCursor is empty on the last
+// page.
+type webhookDeliveryAttemptsPage struct {
+	Attempts   []webhookDeliveryAttempt `json:"attempts"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// oauthError is an OAuth 2.0 error (RFC 6749, sections 4.1.2.1 and 5.2).
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+var (
+	errUnknownOAuthClient  = errors.New("unknown OAuth client")
+	errUnknownRedirectURI  = errors.New("redirect URI is not registered for the client")
+	errMissingRedirectURI  = errors.New("redirect URI must be given when several are registered")
+	errPKCEMethodRequired  = &oauthError{Code: "invalid_request", Description: "code_challenge with code_challenge_method S256 is required"}
+	errUnsupportedResponse = &oauthError{Code: "unsupported_response_type", Description: "only the code response type is supported"}
+)
+
+// authorizationRequest is a checked request for an authorization code.
+type authorizationRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	State         string
+	Scopes        []string
+	CodeChallenge string
+	// RedirectURIGiven is whether the client gave RedirectURI, rather than
+	// it being the only one the client registered. Only then must the
+	// token request give it too.
+	RedirectURIGiven bool
+}
+
+// parseAuthorizationRequest checks an authorization request. Until the
+// client and its redirect URI are known good, errors are plain, and must
+// be shown to the user rather than sent to the redirect URI. Once they
+// are, errors are *oauthError, and the returned request is set enough to
+// redirect them.
+func parseAuthorizationRequest(
+	ctx context.Context,
+	cfg *apiConfig,
+	values url.Values,
+) (authorizationRequest, error) {
+	client, err := cfg.dbQueries.GetOAuthClient(ctx, values.Get("client_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return authorizationRequest{}, errUnknownOAuthClient
+	} else if err != nil {
+		return authorizationRequest{}, err
+	}
+
+	request := authorizationRequest{
+		Client:      client,
+		RedirectURI: values.Get("redirect_uri"),
+		State:       values.Get("state"),
+	}
+	// Redirect URIs are compared exactly, so that codes cannot be sent
+	// anywhere the client has not registered.
+	request.RedirectURIGiven = len(request.RedirectURI) > 0
+	if !request.RedirectURIGiven {
+		if len(client.RedirectUris) != 1 {
+			return authorizationRequest{}, errMissingRedirectURI
+		}
+		request.RedirectURI = client.RedirectUris[0]
+	} else if !slices.Contains(client.RedirectUris, request.RedirectURI) {
+		return authorizationRequest{}, errUnknownRedirectURI
+	}
+
+	if values.Get("response_type") != "code" {
+		return request, errUnsupportedResponse
+	}
+	request.CodeChallenge = values.Get("code_challenge")
+	if len(request.CodeChallenge) == 0 || values.Get("code_challenge_method") != "S256" {
+		return request, errPKCEMethodRequired
+	}
+
+	request.Scopes = strings.Fields(values.Get("scope"))
+	if len(request.Scopes) == 0 {
+		request.Scopes = client.Scopes
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return request, &oauthError{
+				Code:        "invalid_scope",
+				Description: "the client may not be granted " + scope,
+			}
+		}
+	}
+	slices.Sort(request.Scopes)
+	request.Scopes = slices.Compact(request.Scopes)
+
+	return request, nil
+}
+
+// redirectURL returns the redirect URI of request with params added to its
+// query.
+func (request authorizationRequest) redirectURL(params url.Values) string {
+	u, err := url.Parse(request.RedirectURI)
+	if err != nil {
+		// Redirect URIs are checked on registration.
+		panic(err)
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if len(request.State) > 0 {
+		query.Set("state", request.State)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func redirectAuthorizationError(w http.ResponseWriter, r *http.Request, request authorizationRequest, oauthErr *oauthError) {
+	params := url.Values{"error": {oauthErr.Code}}
+	if len(oauthErr.Description) > 0 {
+		params.Set("error_description", oauthErr.Description)
+	}
+	http.Redirect(w, r, request.redirectURL(params), http.StatusSeeOther)
+}
+
+// consentPage is the page a user signs in on and grants a client access.
+// Every field of the authorization request is carried over in the form,
+// which is checked again when posted.
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{if .Error}}Error{{else}}Authorize {{.ClientName}}{{end}} - Chirpy</title>
+</head>
+<body>
+{{if .ClientName}}
+<h1>Authorize {{.ClientName}}</h1>
+<p>{{.ClientName}} would like to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}
+</ul>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Hidden}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}
+<label>Email <input type="email" name="email" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<label>Two-factor code, if enabled <input type="text" name="code" autocomplete="one-time-code" inputmode="numeric"></label>
+<button type="submit" name="decision" value="approve">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+</form>
+{{else}}
+<h1>Error</h1>
+<p>{{.Error}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+type consentPageData struct {
+	ClientName string
+	Scopes     []string
+	Hidden     map[string]string
+	Error      string
+}
+
+func renderConsentPage(w http.ResponseWriter, status int, data consentPageData) {
+	// The page must not be framed, so that users cannot be tricked into
+	// clicking Allow.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := consentPage.Execute(w, data); err != nil {
+		log.Printf("oauth consent page: error in rendering: %v\n", err)
+	}
+}
+
+func newConsentPageData(request authorizationRequest) consentPageData {
+	redirectURI := ""
+	if request.RedirectURIGiven {
+		redirectURI = request.RedirectURI
+	}
+	return consentPageData{
+		ClientName: request.Client.Name,
+		Scopes:     request.Scopes,
+		Hidden: map[string]string{
+			"response_type":         "code",
+			"client_id":             request.Client.ID,
+			"redirect_uri":          redirectURI,
+			"state":                 request.State,
+			"scope":                 strings.Join(request.Scopes, " "),
+			"code_challenge":        request.CodeChallenge,
+			"code_challenge_method": "S256",
+		},
+	}
+}
+
+// authorizeHandler shows the consent page of an authorization request.
+func authorizeHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	request, err := parseAuthorizationRequest(r.Context(), cfg, r.URL.Query())
+	if oauthErr := (*oauthError)(nil); errors.As(err, &oauthErr) {
+		redirectAuthorizationError(w, r, request, oauthErr)
+		return
+	} else if err != nil {
+		log.Printf("GET oauth authorize: error in checking request: %v\n", err)
+		renderConsentPage(w, http.StatusBadRequest, consentPageData{
+			Error: "The application sent an invalid request",
+		})
+		return
+	}
+
+	renderConsentPage(w, http.StatusOK, newConsentPageData(request))
+}
+
+// approveAuthorizationHandler signs the user in and, if they allow it,
+// redirects them back to the client with an authorization code.
+func approveAuthorizationHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("POST oauth authorize: error in parsing form: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	request, err := parseAuthorizationRequest(r.Context(), cfg, r.PostForm)
+	if oauthErr := (*oauthError)(nil); errors.As(err, &oauthErr) {
+		redirectAuthorizationError(w, r, request, oauthErr)
+		return
+	} else if err != nil {
+		log.Printf("POST oauth authorize: error in checking request: %v\n", err)
+		renderConsentPage(w, http.StatusBadRequest, consentPageData{
+			Error: "The application sent an invalid request",
+		})
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		redirectAuthorizationError(w, r, request, &oauthError{
+			Code:        "access_denied",
+			Description: "the user denied the request",
+		})
+		return
+	}
+
+	page := newConsentPageData(request)
+	userID, status, err := signInForConsent(cfg, r)
+	if err != nil {
+		log.Printf("POST oauth authorize: error in signing in: %v\n", err)
+		page.Error = err.Error()
+		if status == http.StatusInternalServerError {
+			page.Error = "Something went wrong"
+		}
+		renderConsentPage(w, status, page)
+		return
+	}
+
+	code, err := auth.MakeOAuthSecret()
+	if err != nil {
+		log.Printf("POST oauth authorize: error in creating code: %v\n", err)
+		page.Error = "Something went wrong"
+		renderConsentPage(w, http.StatusInternalServerError, page)
+		return
+	}
+	if err := cfg.dbQueries.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+		CodeHash:         auth.HashOAuthSecret(code),
+		ClientID:         request.Client.ID,
+		UserID:           userID,
+		RedirectUri:      request.RedirectURI,
+		RedirectUriGiven: request.RedirectURIGiven,
+		Scopes:           request.Scopes,
+		CodeChallenge:    request.CodeChallenge,
+	}); err != nil {
+		log.Printf("POST oauth authorize: error in storing code: %v\n", err)
+		page.Error = "Something went wrong"
+		renderConsentPage(w, http.StatusInternalServerError, page)
+		return
+	}
+
+	http.Redirect(w, r, request.redirectURL(url.Values{"code": {code}}), http.StatusSeeOther)
+}
+
+// signInForConsent checks the credentials posted on the consent page the
+// same way a login does, throttling included. Errors other than internal
+// ones are fit to show the user.
+func signInForConsent(cfg *apiConfig, r *http.Request) (userID uuid.UUID, status int, err error) {
+	email := r.PostForm.Get("email")
+	throttles := []loginThrottle{
+		accountLoginThrottle(email),
+		ipLoginThrottle(r),
+	}
+	if retryAfter, err := loginLockout(r.Context(), cfg, throttles...); err != nil {
+		return userID, http.StatusInternalServerError, err
+	} else if retryAfter > 0 {
+		return userID, http.StatusTooManyRequests, errors.New(tooManyLoginAttemptsMessage)
+	}
+
+	requester, err := cfg.dbQueries.GetUser(r.Context(), sql.NullString{
+		Valid:  true,
+		String: email,
+	})
+	if err == nil {
+		var match bool
+		match, err = auth.CheckPasswordHash(r.PostForm.Get("password"), requester.HashedPassword)
+		if err == nil && !match {
+			err = errors.New(unauthorizedLoginErrorMessage)
+		}
+	}
+	if err != nil {
+		if err := recordLoginFailure(r.Context(), cfg, throttles...); err != nil {
+			log.Printf("POST oauth authorize: error in recording login failure: %v\n", err)
+		}
+		return userID, http.StatusUnauthorized, errors.New(unauthorizedLoginErrorMessage)
+	}
+	if _, err := clearLoginFailures(r.Context(), cfg, throttles[0]); err != nil {
+		log.Printf("POST oauth authorize: error in clearing login failures: %v\n", err)
+	}
+	upgradePasswordHash(r.Context(), cfg, requester, r.PostForm.Get("password"))
+
+	totp, err := cfg.dbQueries.GetUserTOTP(r.Context(), requester.ID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !totp.EnabledAt.Valid {
+		return requester.ID, http.StatusOK, nil
+	} else if err != nil {
+		return userID, http.StatusInternalServerError, err
+	}
+
+	twoFactorThrottles := []loginThrottle{
+		twoFactorLoginThrottle(requester.ID),
+		throttles[1],
+	}
+	if retryAfter, err := loginLockout(r.Context(), cfg, twoFactorThrottles...); err != nil {
+		return userID, http.StatusInternalServerError, err
+	} else if retryAfter > 0 {
+		return userID, http.StatusTooManyRequests, errors.New(tooManyLoginAttemptsMessage)
+	}
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return userID, http.StatusInternalServerError, err
+	}
+	defer tx.Rollback()
+	passed, err := verifySecondFactor(r.Context(), cfg, cfg.dbQueries.WithTx(tx), requester.ID, secondFactor{
+		Code: r.PostForm.Get("code"),
+	})
+	if err != nil {
+		return userID, http.StatusInternalServerError, err
+	}
+	if !passed {
+		if err := recordLoginFailure(r.Context(), cfg, twoFactorThrottles...); err != nil {
+			log.Printf("POST oauth authorize: error in recording login failure: %v\n", err)
+		}
+		return userID, http.StatusUnauthorized, errors.New("Incorrect two-factor code")
+	}
+	if err := tx.Commit(); err != nil {
+		return userID, http.StatusInternalServerError, err
+	}
+	if _, err := clearLoginFailures(r.Context(), cfg, twoFactorThrottles[0]); err != nil {
+		log.Printf("POST oauth authorize: error in clearing login failures: %v\n", err)
+	}
+	return requester.ID, http.StatusOK, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NOTE: follows the generated model database.OauthClient
+type oauthClient struct {
+	ID           string       `json:"client_id"`
+	Name         string       `json:"name"`
+	RedirectURIs []string     `json:"redirect_uris"`
+	Scopes       []tokenScope `json:"scopes"`
+	// Confidential clients authenticate with a secret. Public ones, such
+	// as mobile apps, cannot keep one and rely on PKCE alone.
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newOAuthClient(c database.OauthClient) oauthClient {
+	response := oauthClient{
+		ID:           c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Scopes:       make([]tokenScope, 0, len(c.Scopes)),
+		Confidential: c.SecretHash.Valid,
+		CreatedAt:    c.CreatedAt,
+	}
+	for _, scope := range c.Scopes {
+		response.Scopes = append(response.Scopes, tokenScope(scope))
+	}
+	return response
+}
+
+// validateRedirectURI checks that uri is fit to send authorization codes
+// to: an absolute https URL, or an http one on the loopback interface for
+// native apps (RFC 8252, section 7.3).
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	if len(u.Fragment) > 0 {
+		return fmt.Errorf("redirect URI %q must not have a fragment", uri)
+	}
+	switch u.Scheme {
+	case "https":
+		if len(u.Host) == 0 {
+			return fmt.Errorf("redirect URI %q has no host", uri)
+		}
+		return nil
+	case "http":
+		if ip := net.ParseIP(u.Hostname()); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+		if u.Hostname() == "localhost" {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect URI %q must be https, or http on the loopback interface", uri)
+}
+
+// createOAuthClientHandler registers an OAuth client owned by the caller.
+// Managing clients takes a login.
+func createOAuthClientHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		Name         string       `json:"name"`
+		RedirectURIs []string     `json:"redirect_uris"`
+		Scopes       []tokenScope `json:"scopes"`
+		Confidential bool         `json:"confidential"`
+	}
+	type responsePayload struct {
+		oauthClient
+		// ClientSecret is only ever shown here.
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST oauth clients: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("POST oauth clients: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST oauth clients: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(request.Name) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Name is required",
+		})
+		return
+	}
+	if len(request.RedirectURIs) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "At least one redirect URI is required",
+		})
+		return
+	}
+	for _, uri := range request.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: err.Error(),
+			})
+			return
+		}
+	}
+	if len(request.Scopes) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "At least one scope is required",
+		})
+		return
+	}
+	scopes := make([]string, 0, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if !slices.Contains(tokenScopes, scope) {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: fmt.Sprintf("Unknown scope %q", scope),
+			})
+			return
+		}
+		if !slices.Contains(scopes, string(scope)) {
+			scopes = append(scopes, string(scope))
+		}
+	}
+
+	response := responsePayload{}
+	secretHash := sql.NullString{}
+	if request.Confidential {
+		response.ClientSecret, err = auth.MakeOAuthSecret()
+		if err != nil {
+			log.Printf("POST oauth clients: error in creating client secret: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		secretHash = sql.NullString{
+			String: auth.HashOAuthSecret(response.ClientSecret),
+			Valid:  true,
+		}
+	}
+
+	client, err := cfg.dbQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		ID:           uuid.NewString(),
+		OwnerID:      userID,
+		Name:         request.Name,
+		SecretHash:   secretHash,
+		RedirectUris: request.RedirectURIs,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		log.Printf("POST oauth clients: error in storing client: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response.oauthClient = newOAuthClient(client)
+
+	jsonResponse(w, http.StatusCreated, response)
+}
+
+func listOAuthClientsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("GET oauth clients: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("GET oauth clients: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	clients, err := cfg.dbQueries.ListOAuthClients(r.Context(), userID)
+	if err != nil {
+		log.Printf("GET oauth clients: error in getting clients: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]oauthClient, 0, len(clients))
+	for _, c := range clients {
+		response = append(response, newOAuthClient(c))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// deleteOAuthClientHandler deletes a client along with every session
+// granted to it.
+func deleteOAuthClientHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("DELETE oauth client: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("DELETE oauth client: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      r.PathValue("clientID"),
+		OwnerID: userID,
+	})
+	if err != nil {
+		log.Printf("DELETE oauth client: error in deleting client: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
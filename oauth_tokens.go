@@ -0,0 +1,414 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var errInvalidGrant = &oauthError{
+	Code:        "invalid_grant",
+	Description: "the grant is invalid, expired, revoked or was issued to another client",
+}
+
+// writeOAuthError responds with an error of the token, revocation or
+// introspection endpoints (RFC 6749, section 5.2).
+func writeOAuthError(w http.ResponseWriter, r *http.Request, oauthErr *oauthError) {
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, status, oauthErr)
+}
+
+// authenticateOAuthClient returns the client a request to the token,
+// revocation or introspection endpoints is made by. Confidential clients
+// authenticate with HTTP Basic or with client_secret in the form, public
+// ones only name themselves with client_id.
+func authenticateOAuthClient(ctx context.Context, cfg *apiConfig, r *http.Request) (database.OauthClient, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		// Both are form encoded before being put in the header (RFC 6749,
+		// section 2.3.1).
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return database.OauthClient{}, err
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return database.OauthClient{}, err
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	client, err := cfg.dbQueries.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	if !client.SecretHash.Valid {
+		if len(secret) > 0 {
+			return database.OauthClient{}, fmt.Errorf("public client %v sent a secret", client.ID)
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare(
+		[]byte(auth.HashOAuthSecret(secret)),
+		[]byte(client.SecretHash.String),
+	) != 1 {
+		return database.OauthClient{}, fmt.Errorf("wrong secret for client %v", client.ID)
+	}
+	return client, nil
+}
+
+// tokenHandler exchanges authorization codes and refresh tokens for tokens
+// (RFC 6749, sections 4.1.3 and 6).
+func tokenHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope,omitempty"`
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("POST oauth token: error in parsing form: %v\n", err)
+		writeOAuthError(w, r, &oauthError{Code: "invalid_request"})
+		return
+	}
+	client, err := authenticateOAuthClient(r.Context(), cfg, r)
+	if err != nil {
+		log.Printf("POST oauth token: error in authenticating client: %v\n", err)
+		writeOAuthError(w, r, &oauthError{Code: "invalid_client"})
+		return
+	}
+	clientID := sql.NullString{String: client.ID, Valid: true}
+
+	response := responsePayload{
+		TokenType: "Bearer",
+		ExpiresIn: int(accessTokenExpiresIn.Seconds()),
+	}
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		session, tokens, err := exchangeAuthorizationCode(cfg, r, client)
+		if oauthErr := (*oauthError)(nil); errors.As(err, &oauthErr) {
+			log.Printf("POST oauth token: error in exchanging code: %v\n", err)
+			writeOAuthError(w, r, oauthErr)
+			return
+		} else if err != nil {
+			log.Printf("POST oauth token: error in exchanging code: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		response.AccessToken = tokens.AccessToken
+		response.RefreshToken = tokens.RefreshToken
+		response.Scope = strings.Join(session.Scopes, " ")
+	case "refresh_token":
+		// The scope of a refresh is always that of the session, so it is
+		// left out of the response (RFC 6749, section 5.1).
+		tokens, err := refreshSession(cfg, r, r.PostForm.Get("refresh_token"), clientID)
+		if errors.Is(err, errRefreshTokenInvalid) || errors.Is(err, errRefreshTokenReused) {
+			log.Printf("POST oauth token: error in refreshing session: %v\n", err)
+			writeOAuthError(w, r, errInvalidGrant)
+			return
+		} else if err != nil {
+			log.Printf("POST oauth token: error in refreshing session: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		response.AccessToken = tokens.AccessToken
+		response.RefreshToken = tokens.RefreshToken
+	default:
+		writeOAuthError(w, r, &oauthError{Code: "unsupported_grant_type"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// exchangeAuthorizationCode starts a session for the authorization code
+// posted to the token endpoint by client.
+func exchangeAuthorizationCode(
+	cfg *apiConfig,
+	r *http.Request,
+	client database.OauthClient,
+) (database.Session, sessionTokens, error) {
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.Session{}, sessionTokens{}, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// The row is locked so that concurrent exchanges of the same code
+	// cannot both succeed.
+	code, err := qtx.GetAuthorizationCodeForUpdate(r.Context(), auth.HashOAuthSecret(r.PostForm.Get("code")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Session{}, sessionTokens{}, errInvalidGrant
+	} else if err != nil {
+		return database.Session{}, sessionTokens{}, fmt.Errorf("getting code: %w", err)
+	}
+	if code.ClientID != client.ID {
+		return database.Session{}, sessionTokens{}, errInvalidGrant
+	}
+
+	if code.UsedAt.Valid {
+		// A code presented twice may have been intercepted, so the
+		// session it was exchanged for is revoked (RFC 6749, section
+		// 4.1.2).
+		if code.SessionID.Valid {
+			_, err := qtx.RevokeRefreshTokenFamily(r.Context(), code.SessionID.UUID)
+			if err == nil {
+				_, err = qtx.RevokeSession(r.Context(), database.RevokeSessionParams{
+					ID:     code.SessionID.UUID,
+					UserID: code.UserID,
+				})
+			}
+			if err == nil {
+				err = tx.Commit()
+			}
+			if err != nil {
+				return database.Session{}, sessionTokens{}, fmt.Errorf("revoking session: %w", err)
+			}
+		}
+		log.Printf(
+			"SECURITY: reuse of authorization code detected: user %v, client %v, remote %v\n",
+			code.UserID,
+			client.ID,
+			r.RemoteAddr,
+		)
+		return database.Session{}, sessionTokens{}, errInvalidGrant
+	}
+
+	if code.RedirectUriGiven && code.RedirectUri != r.PostForm.Get("redirect_uri") {
+		return database.Session{}, sessionTokens{}, errInvalidGrant
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		return database.Session{}, sessionTokens{}, errInvalidGrant
+	}
+
+	session, tokens, err := startSession(cfg, qtx, r, code.UserID, sessionGrant{
+		ClientID: sql.NullString{String: client.ID, Valid: true},
+		Scopes:   code.Scopes,
+	})
+	if err != nil {
+		return database.Session{}, sessionTokens{}, err
+	}
+	// Expiry is left to the database, whose clock the expiry was set by.
+	if used, err := qtx.UseAuthorizationCode(r.Context(), database.UseAuthorizationCodeParams{
+		CodeHash: code.CodeHash,
+		SessionID: uuid.NullUUID{
+			UUID:  session.ID,
+			Valid: true,
+		},
+	}); err != nil {
+		return database.Session{}, sessionTokens{}, fmt.Errorf("using code: %w", err)
+	} else if used == 0 {
+		return database.Session{}, sessionTokens{}, errInvalidGrant
+	}
+	if err := tx.Commit(); err != nil {
+		return database.Session{}, sessionTokens{}, fmt.Errorf("committing transaction: %w", err)
+	}
+	return session, tokens, nil
+}
+
+// oauthRevokeHandler revokes a refresh token of the client, along with its
+// session (RFC 7009). Access tokens cannot be revoked, they expire within
+// accessTokenExpiresIn.
+func oauthRevokeHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("POST oauth revoke: error in parsing form: %v\n", err)
+		writeOAuthError(w, r, &oauthError{Code: "invalid_request"})
+		return
+	}
+	client, err := authenticateOAuthClient(r.Context(), cfg, r)
+	if err != nil {
+		log.Printf("POST oauth revoke: error in authenticating client: %v\n", err)
+		writeOAuthError(w, r, &oauthError{Code: "invalid_client"})
+		return
+	}
+
+	session, _, err := getClientSession(r.Context(), cfg, client, r.PostForm.Get("token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Tokens that are invalid, or not the client's, are not an error
+		// (RFC 7009, section 2.2).
+		w.WriteHeader(http.StatusOK)
+		return
+	} else if err != nil {
+		log.Printf("POST oauth revoke: error in getting session: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("POST oauth revoke: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+	if _, err := qtx.RevokeRefreshTokenFamily(r.Context(), session.ID); err != nil {
+		log.Printf("POST oauth revoke: error in revoking refresh tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if _, err := qtx.RevokeSession(r.Context(), database.RevokeSessionParams{
+		ID:     session.ID,
+		UserID: session.UserID,
+	}); err != nil {
+		log.Printf("POST oauth revoke: error in revoking session: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("POST oauth revoke: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// getClientSession returns the session of a valid refresh token of
+// client. sql.ErrNoRows is returned for any other token.
+func getClientSession(
+	ctx context.Context,
+	cfg *apiConfig,
+	client database.OauthClient,
+	token string,
+) (database.Session, database.RefreshToken, error) {
+	refreshToken, err := cfg.dbQueries.GetRefreshToken(ctx, token)
+	if err != nil {
+		return database.Session{}, database.RefreshToken{}, err
+	}
+	session, err := cfg.dbQueries.GetSession(ctx, refreshToken.FamilyID)
+	if err != nil {
+		return database.Session{}, database.RefreshToken{}, err
+	}
+	if session.ClientID.String != client.ID || session.RevokedAt.Valid {
+		return database.Session{}, database.RefreshToken{}, sql.ErrNoRows
+	}
+	return session, refreshToken, nil
+}
+
+// introspectHandler tells a confidential client whether one of its tokens
+// is active, and what it grants (RFC 7662).
+func introspectHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Subject   string `json:"sub,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		ExpiresAt int64  `json:"exp,omitempty"`
+		IssuedAt  int64  `json:"iat,omitempty"`
+		Issuer    string `json:"iss,omitempty"`
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("POST oauth introspect: error in parsing form: %v\n", err)
+		writeOAuthError(w, r, &oauthError{Code: "invalid_request"})
+		return
+	}
+	// Public clients cannot authenticate, so anyone could introspect in
+	// their name.
+	client, err := authenticateOAuthClient(r.Context(), cfg, r)
+	if err == nil && !client.SecretHash.Valid {
+		err = fmt.Errorf("public client %v may not introspect", client.ID)
+	}
+	if err != nil {
+		log.Printf("POST oauth introspect: error in authenticating client: %v\n", err)
+		writeOAuthError(w, r, &oauthError{Code: "invalid_client"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	token := r.PostForm.Get("token")
+	if claims, err := auth.ValidateAccessJWT(token, cfg.jwtKeys); err == nil {
+		if claims.ClientID != client.ID {
+			jsonResponse(w, http.StatusOK, responsePayload{})
+			return
+		}
+		jsonResponse(w, http.StatusOK, responsePayload{
+			Active:    true,
+			Scope:     strings.Join(claims.Scopes, " "),
+			ClientID:  claims.ClientID,
+			Subject:   claims.UserID.String(),
+			TokenType: "Bearer",
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+			Issuer:    cfg.jwtKeys.Issuer(),
+		})
+		return
+	}
+
+	session, refreshToken, err := getClientSession(r.Context(), cfg, client, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonResponse(w, http.StatusOK, responsePayload{})
+		return
+	} else if err != nil {
+		log.Printf("POST oauth introspect: error in getting session: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, responsePayload{
+		Active:    true,
+		Scope:     strings.Join(session.Scopes, " "),
+		ClientID:  client.ID,
+		Subject:   session.UserID.String(),
+		TokenType: "refresh_token",
+		ExpiresAt: refreshToken.ExpiresAt.Time.Unix(),
+		IssuedAt:  refreshToken.CreatedAt.Time.Unix(),
+		Issuer:    cfg.jwtKeys.Issuer(),
+	})
+}
+
+// oauthMetadataHandler publishes the authorization server's metadata (RFC
+// 8414), for clients to find its endpoints with.
+func oauthMetadataHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload struct {
+		Issuer                            string       `json:"issuer"`
+		AuthorizationEndpoint             string       `json:"authorization_endpoint"`
+		TokenEndpoint                     string       `json:"token_endpoint"`
+		RevocationEndpoint                string       `json:"revocation_endpoint"`
+		IntrospectionEndpoint             string       `json:"introspection_endpoint"`
+		JWKSURI                           string       `json:"jwks_uri"`
+		ScopesSupported                   []tokenScope `json:"scopes_supported"`
+		ResponseTypesSupported            []string     `json:"response_types_supported"`
+		GrantTypesSupported               []string     `json:"grant_types_supported"`
+		CodeChallengeMethodsSupported     []string     `json:"code_challenge_methods_supported"`
+		TokenEndpointAuthMethodsSupported []string     `json:"token_endpoint_auth_methods_supported"`
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	jsonResponse(w, http.StatusOK, responsePayload{
+		Issuer:                            cfg.jwtKeys.Issuer(),
+		AuthorizationEndpoint:             cfg.publicURL + "/oauth/authorize",
+		TokenEndpoint:                     cfg.publicURL + "/oauth/token",
+		RevocationEndpoint:                cfg.publicURL + "/oauth/revoke",
+		IntrospectionEndpoint:             cfg.publicURL + "/oauth/introspect",
+		JWKSURI:                           cfg.publicURL + "/.well-known/jwks.json",
+		ScopesSupported:                   tokenScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"ValenTheRed/chirpy/internal/oidc"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// oidcStateCookie binds a sign in with the provider to the browser that
+// started it, so that no one can finish their sign in in someone else's
+// browser.
+const oidcStateCookie = "chirpy_oidc_state"
+
+// noPassword is the hashed password of users who have never set one, such
+// as those who signed up with a provider. It matches no password.
+const noPassword = "unset"
+
+var (
+	errIdentityEmailUnverified = errors.New("provider has not verified the email")
+	errAccountEmailUnverified  = errors.New("account with the email has not verified it")
+)
+
+// oidcLoginHandler starts a sign in with the provider.
+func oidcLoginHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	if cfg.oidcProvider == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	state, err := auth.MakeOAuthSecret()
+	if err != nil {
+		log.Printf("GET login oidc: error in creating state: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	nonce, err := auth.MakeOAuthSecret()
+	if err != nil {
+		log.Printf("GET login oidc: error in creating nonce: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	verifier, err := auth.MakePKCEVerifier()
+	if err != nil {
+		log.Printf("GET login oidc: error in creating code verifier: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := cfg.dbQueries.DeleteExpiredOIDCLoginStates(r.Context()); err != nil {
+		log.Printf("GET login oidc: error in deleting expired states: %v\n", err)
+	}
+	if err := cfg.dbQueries.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashOAuthSecret(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}); err != nil {
+		log.Printf("GET login oidc: error in storing state: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/login/oidc",
+		MaxAge:   10 * 60,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.publicURL, "https://"),
+		// Lax, as the provider sends the user back with a top level
+		// navigation from another site.
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, cfg.oidcProvider.AuthCodeURL(state, nonce, auth.PKCEChallenge(verifier)), http.StatusFound)
+}
+
+// oidcCallbackHandler finishes a sign in with the provider. It responds
+// like a login does.
+func oidcCallbackHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload struct {
+		user
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if cfg.oidcProvider == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); len(providerErr) > 0 {
+		log.Printf("GET login oidc callback: provider error %v: %v\n", providerErr, query.Get("error_description"))
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Sign in with the provider failed",
+		})
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || len(state) == 0 || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.Printf("GET login oidc callback: state does not match the cookie\n")
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Sign in could not be verified, try again",
+		})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/api/login/oidc",
+		MaxAge: -1,
+	})
+	loginState, err := cfg.dbQueries.UseOIDCLoginState(r.Context(), auth.HashOAuthSecret(state))
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Sign in could not be verified, try again",
+		})
+		return
+	} else if err != nil {
+		log.Printf("GET login oidc callback: error in getting state: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := cfg.oidcProvider.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("GET login oidc callback: error in exchanging code: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Sign in with the provider failed",
+		})
+		return
+	}
+
+	requester, err := signInWithIdentity(r.Context(), cfg, cfg.oidcProvider.Issuer(), claims)
+	if errors.Is(err, errIdentityEmailUnverified) {
+		jsonResponse(w, http.StatusForbidden, errorPayload{
+			Error: "The provider has not verified your email",
+		})
+		return
+	} else if errors.Is(err, errAccountEmailUnverified) {
+		jsonResponse(w, http.StatusConflict, errorPayload{
+			Error: "An account with your email exists, verify its email to sign in with the provider",
+		})
+		return
+	} else if err != nil {
+		log.Printf("GET login oidc callback: error in signing in: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Users who have two-factor authentication enabled go through it
+	// whichever way they sign in.
+	if challenge, err := twoFactorChallenge(r.Context(), cfg, requester.ID); err != nil {
+		log.Printf("GET login oidc callback: error in challenge token creation: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if challenge != nil {
+		jsonResponse(w, http.StatusOK, challenge)
+		return
+	}
+
+	token, refreshToken, err := issueTokens(cfg, r, requester.ID)
+	if err != nil {
+		log.Printf("GET login oidc callback: error in issuing tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	isChirpyRed, err := cfg.dbQueries.IsUserChirpyRed(r.Context(), requester.ID)
+	if err != nil {
+		log.Printf("GET login oidc callback: error in getting subscription: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, responsePayload{
+		user:         newUser(cfg, requester, isChirpyRed),
+		Token:        token,
+		RefreshToken: refreshToken,
+	})
+}
+
+// signInWithIdentity returns the user an identity at issuer belongs to.
+// An identity seen for the first time is linked to the user with the same
+// email, or to a new user if there is none. Both sides must have verified
+// the email, lest someone take over an account by signing up with its
+// email ahead of its owner.
+func signInWithIdentity(
+	ctx context.Context,
+	cfg *apiConfig,
+	issuer string,
+	claims oidc.Claims,
+) (database.User, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	identity, err := qtx.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		if err := qtx.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			ID:    identity.ID,
+			Email: claims.Email,
+		}); err != nil {
+			return database.User{}, fmt.Errorf("updating identity: %w", err)
+		}
+		requester, err := qtx.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			return database.User{}, fmt.Errorf("getting user: %w", err)
+		}
+		return requester, tx.Commit()
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("getting identity: %w", err)
+	}
+
+	if !claims.EmailVerified || len(claims.Email) == 0 {
+		return database.User{}, errIdentityEmailUnverified
+	}
+	email := sql.NullString{
+		String: claims.Email,
+		Valid:  true,
+	}
+	requester, err := qtx.GetUser(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		requester, err = qtx.CreateUserWithVerifiedEmail(ctx, email)
+		if err != nil {
+			return database.User{}, fmt.Errorf("creating user: %w", err)
+		}
+	} else if err != nil {
+		return database.User{}, fmt.Errorf("getting user: %w", err)
+	} else if !requester.EmailVerifiedAt.Valid {
+		return database.User{}, errAccountEmailUnverified
+	}
+
+	if _, err := qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:  requester.ID,
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}); err != nil {
+		return database.User{}, fmt.Errorf("storing identity: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return database.User{}, fmt.Errorf("committing transaction: %w", err)
+	}
+	log.Printf("SECURITY: identity linked: user %v, issuer %v, subject %v\n", requester.ID, issuer, claims.Subject)
+	return requester, nil
+}
+
+func listIdentitiesHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("GET identities: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("GET identities: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := cfg.dbQueries.ListUserIdentities(r.Context(), userID)
+	if err != nil {
+		log.Printf("GET identities: error in getting identities: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]identity, 0, len(identities))
+	for _, i := range identities {
+		response = append(response, identity{
+			ID:          i.ID,
+			Issuer:      i.Issuer,
+			Subject:     i.Subject,
+			Email:       i.Email,
+			CreatedAt:   i.CreatedAt,
+			LastLoginAt: i.LastLoginAt,
+		})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// unlinkIdentityHandler unlinks an identity from the caller. The last
+// identity of a user without a password stays, so that they can still
+// sign in.
+func unlinkIdentityHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("DELETE identity: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("DELETE identity: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	identityID, err := uuid.Parse(r.PathValue("identityID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	requester, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("DELETE identity: error in getting user: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if requester.HashedPassword == noPassword {
+		identities, err := cfg.dbQueries.ListUserIdentities(r.Context(), userID)
+		if err != nil {
+			log.Printf("DELETE identity: error in getting identities: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(identities) == 1 && identities[0].ID == identityID {
+			jsonResponse(w, http.StatusConflict, errorPayload{
+				Error: "Set a password before unlinking your last identity",
+			})
+			return
+		}
+	}
+
+	deleted, err := cfg.dbQueries.DeleteUserIdentity(r.Context(), database.DeleteUserIdentityParams{
+		ID:     identityID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("DELETE identity: error in deleting identity: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"ValenTheRed/chirpy/internal/webhook"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// outboxEvent is a type of event sent to webhook endpoints.
+type outboxEvent string
+
+const (
+	outboxChirpCreated outboxEvent = "chirp.created"
+	outboxChirpDeleted outboxEvent = "chirp.deleted"
+	outboxUserUpgraded outboxEvent = "user.upgraded"
+)
+
+// outboxEvents are the events webhook endpoints can receive.
+var outboxEvents = []outboxEvent{
+	outboxChirpCreated,
+	outboxChirpDeleted,
+	outboxUserUpgraded,
+}
+
+// maxWebhookEndpoints is how many webhook endpoints a user can have.
+const maxWebhookEndpoints = 10
+
+// webhookChirp is the data of chirp events.
+type webhookChirp struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Body      string     `json:"body,omitempty"`
+	InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
+	CreatedAt time.Time  `json:"created_at,omitzero"`
+}
+
+func newWebhookChirp(c database.Chirp) webhookChirp {
+	data := webhookChirp{
+		ID:        c.ID,
+		UserID:    c.UserID.UUID,
+		Body:      c.Body.String,
+		CreatedAt: c.CreatedAt.Time,
+	}
+	if c.InReplyTo.Valid {
+		data.InReplyTo = &c.InReplyTo.UUID
+	}
+	return data
+}
+
+// webhookSubscription is the data of subscription events.
+type webhookSubscription struct {
+	UserID           uuid.UUID `json:"user_id"`
+	Status           string    `json:"status"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+// enqueueOutboxEvent records that event happened to user userID, with
+// data, for it to be sent to webhook endpoints. q is expected to be within
+// the transaction that made the change, so that the event is recorded if
+// and only if the change is.
+func enqueueOutboxEvent(ctx context.Context, q *database.Queries, event outboxEvent, userID uuid.UUID, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error in encoding %v event: %w", event, err)
+	}
+	if err := q.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{
+		EventType: string(event),
+		UserID: uuid.NullUUID{
+			UUID:  userID,
+			Valid: true,
+		},
+		Payload: payload,
+	}); err != nil {
+		return fmt.Errorf("error in recording %v event: %w", event, err)
+	}
+	return nil
+}
+
+// webhookOwner authenticates the caller of a webhook endpoint route. An
+// admin, with the admin API key, manages every endpoint, and creates ones
+// that receive every event. A user, with a login, manages their own, which
+// only receive events about them. The owner is null for admins.
+func webhookOwner(cfg *apiConfig, r *http.Request) (uuid.NullUUID, error) {
+	if _, err := auth.GetAPIKey(r.Header); err == nil {
+		return uuid.NullUUID{}, authenticateAdmin(cfg, r)
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{
+		UUID:  userID,
+		Valid: true,
+	}, nil
+}
+
+// validateWebhookURL checks that uri is an absolute http or https URL.
+// Users' endpoints must be https.
+func validateWebhookURL(uri string, owner uuid.NullUUID) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("URL %q is invalid", uri)
+	}
+	if len(u.Host) == 0 || u.User != nil {
+		return fmt.Errorf("URL %q must have a host and no credentials", uri)
+	}
+	switch {
+	case u.Scheme == "https":
+		return nil
+	case u.Scheme == "http" && !owner.Valid:
+		return nil
+	}
+	return fmt.Errorf("URL %q must be https", uri)
+}
+
+func newWebhookEndpoint(e database.WebhookEndpoint) webhookEndpoint {
+	response := webhookEndpoint{
+		ID:                  e.ID,
+		URL:                 e.Url,
+		EventTypes:          e.EventTypes,
+		CreatedAt:           e.CreatedAt,
+		UpdatedAt:           e.UpdatedAt,
+		ConsecutiveFailures: e.ConsecutiveFailures,
+	}
+	if e.DisabledAt.Valid {
+		response.DisabledAt = &e.DisabledAt.Time
+	}
+	return response
+}
+
+func createWebhookEndpointHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		URL        string        `json:"url"`
+		EventTypes []outboxEvent `json:"event_types"`
+	}
+	type responsePayload struct {
+		webhookEndpoint
+		// Secret is only ever shown here.
+		Secret string `json:"secret"`
+	}
+
+	owner, err := webhookOwner(cfg, r)
+	if err != nil {
+		log.Printf("POST webhooks: error in authenticating: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST webhooks: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhookURL(request.URL, owner); err != nil {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: err.Error(),
+		})
+		return
+	}
+	if len(request.EventTypes) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "At least one event type is required",
+		})
+		return
+	}
+	eventTypes := make([]string, 0, len(request.EventTypes))
+	for _, event := range request.EventTypes {
+		if !slices.Contains(outboxEvents, event) {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: fmt.Sprintf("Unknown event type %q", event),
+			})
+			return
+		}
+		if !slices.Contains(eventTypes, string(event)) {
+			eventTypes = append(eventTypes, string(event))
+		}
+	}
+
+	if owner.Valid {
+		endpoints, err := cfg.dbQueries.ListWebhookEndpoints(r.Context(), owner)
+		if err != nil {
+			log.Printf("POST webhooks: error in getting endpoints: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(endpoints) >= maxWebhookEndpoints {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: fmt.Sprintf("A user can have up to %d webhook endpoints", maxWebhookEndpoints),
+			})
+			return
+		}
+	}
+
+	secret, err := webhook.MakeSecret()
+	if err != nil {
+		log.Printf("POST webhooks: error in creating secret: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	endpoint, err := cfg.dbQueries.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:     owner,
+		Url:        request.URL,
+		EventTypes: eventTypes,
+		Secret:     secret,
+	})
+	if err != nil {
+		log.Printf("POST webhooks: error in storing endpoint: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, responsePayload{
+		webhookEndpoint: newWebhookEndpoint(endpoint),
+		Secret:          secret,
+	})
+}
+
+func listWebhookEndpointsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	owner, err := webhookOwner(cfg, r)
+	if err != nil {
+		log.Printf("GET webhooks: error in authenticating: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	endpoints, err := cfg.dbQueries.ListWebhookEndpoints(r.Context(), owner)
+	if err != nil {
+		log.Printf("GET webhooks: error in getting endpoints: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]webhookEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		response = append(response, newWebhookEndpoint(endpoint))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+func deleteWebhookEndpointHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	owner, err := webhookOwner(cfg, r)
+	if err != nil {
+		log.Printf("DELETE webhook: error in authenticating: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: owner,
+	})
+	if err != nil {
+		log.Printf("DELETE webhook: error in deleting endpoint: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// enableWebhookEndpointHandler enables an endpoint that was disabled after
+// failing too many times in a row. Deliveries that were pending are sent
+// again.
+func enableWebhookEndpointHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	owner, err := webhookOwner(cfg, r)
+	if err != nil {
+		log.Printf("POST webhook enable: error in authenticating: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	endpoint, err := cfg.dbQueries.EnableWebhookEndpoint(r.Context(), database.EnableWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: owner,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("POST webhook enable: error in enabling endpoint: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, newWebhookEndpoint(endpoint))
+}
+
+// listWebhookDeliveryAttemptsHandler lists the attempts at delivering to
+// an endpoint, newest first.
+func listWebhookDeliveryAttemptsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload webhookDeliveryAttemptsPage
+
+	owner, err := webhookOwner(cfg, r)
+	if err != nil {
+		log.Printf("GET webhook attempts: error in authenticating: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET webhook attempts: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	cursorCreatedAt, cursorID, err := parsePageCursor(query.Get("cursor"))
+	if err != nil {
+		log.Printf("GET webhook attempts: error in decoding cursor: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid cursor",
+		})
+		return
+	}
+
+	if _, err := cfg.dbQueries.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: owner,
+	}); errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("GET webhook attempts: error in getting endpoint: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// One extra row is fetched to know whether a next page exists.
+	attempts, err := cfg.dbQueries.ListWebhookDeliveryAttempts(r.Context(), database.ListWebhookDeliveryAttemptsParams{
+		EndpointID:      endpointID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        limit + 1,
+	})
+	if err != nil {
+		log.Printf("GET webhook attempts: error in retrieving attempts: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(attempts) > int(limit) {
+		attempts = attempts[:limit]
+		last := attempts[len(attempts)-1]
+		response.NextCursor = pageCursor{
+			CreatedAt: last.AttemptedAt,
+			ID:        last.ID,
+		}.encode()
+	}
+	response.Attempts = make([]webhookDeliveryAttempt, 0, len(attempts))
+	for _, a := range attempts {
+		attempt := webhookDeliveryAttempt{
+			ID:          a.ID,
+			DeliveryID:  a.DeliveryID,
+			EventID:     a.EventID,
+			EventType:   a.EventType,
+			AttemptedAt: a.AttemptedAt,
+			DurationMs:  a.DurationMs,
+		}
+		if a.StatusCode.Valid {
+			attempt.StatusCode = &a.StatusCode.Int32
+		}
+		if a.Error.Valid {
+			attempt.Error = &a.Error.String
+		}
+		response.Attempts = append(response.Attempts, attempt)
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var errInvalidCursor = errors.New("cursor is invalid")
+
+// pageCursor is the keyset position of the last row of a page. Rows are
+// ordered by (created_at, id) so that rows sharing a timestamp still have
+// a stable order.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// encode returns the cursor in an opaque form, fit for a query parameter.
+func (c pageCursor) encode() string {
+	raw := fmt.Sprintf("%d:%s", c.CreatedAt.UnixMicro(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	microString, idString, found := strings.Cut(string(raw), ":")
+	if !found {
+		return pageCursor{}, errInvalidCursor
+	}
+	micro, err := strconv.ParseInt(microString, 10, 64)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	return pageCursor{
+		CreatedAt: time.UnixMicro(micro).UTC(),
+		ID:        id,
+	}, nil
+}
+
+// parsePageCursor parses the `cursor` query parameter into the nullable
+// keyset position taken by the paginated queries. An empty string gives
+// invalid values, that is, the first page.
+func parsePageCursor(s string) (sql.NullTime, uuid.NullUUID, error) {
+	if len(s) == 0 {
+		return sql.NullTime{}, uuid.NullUUID{}, nil
+	}
+	cursor, err := decodePageCursor(s)
+	if err != nil {
+		return sql.NullTime{}, uuid.NullUUID{}, err
+	}
+	createdAt := sql.NullTime{
+		Time:  cursor.CreatedAt,
+		Valid: true,
+	}
+	id := uuid.NullUUID{
+		UUID:  cursor.ID,
+		Valid: true,
+	}
+	return createdAt, id, nil
+}
+
+// parsePageLimit parses the `limit` query parameter. An empty string gives
+// the default limit and values above maxPageLimit are clamped.
+func parsePageLimit(s string) (int32, error) {
+	if len(s) == 0 {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("limit must be a positive integer: %q", s)
+	}
+	return int32(min(limit, maxPageLimit)), nil
+}
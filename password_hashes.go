@@ -0,0 +1,110 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"log"
+	"net/http"
+)
+
+// upgradePasswordHash rehashes password, which has just been checked
+// against u's hash, if the hash was made with weaker parameters than are
+// configured. Failing to is logged, not returned, as the login itself has
+// succeeded.
+func upgradePasswordHash(ctx context.Context, cfg *apiConfig, u database.User, password string) {
+	needsRehash, err := auth.NeedsRehash(u.HashedPassword, cfg.passwordParams)
+	if err != nil {
+		log.Printf("Error in checking password hash parameters: %v\n", err)
+		return
+	}
+	if !needsRehash {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(password, cfg.passwordParams)
+	if err != nil {
+		log.Printf("Error in rehashing password: %v\n", err)
+		return
+	}
+	if _, err := cfg.dbQueries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: hashedPassword,
+		ID:      u.ID,
+		OldHash: u.HashedPassword,
+	}); err != nil {
+		log.Printf("Error in storing rehashed password: %v\n", err)
+	}
+}
+
+// passwordHashesReportHandler reports how many users have their password
+// hashed with each set of parameters, and how many of those are weaker
+// than the configured ones. Users only move off weaker parameters when
+// they next log in.
+func passwordHashesReportHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type params struct {
+		MemoryKiB   uint32 `json:"memory_kib"`
+		Iterations  uint32 `json:"iterations"`
+		Parallelism uint8  `json:"parallelism"`
+	}
+	type paramsCount struct {
+		params
+		Users    int64 `json:"users"`
+		Outdated bool  `json:"outdated"`
+	}
+	type responsePayload struct {
+		Params   params        `json:"params"`
+		Users    int64         `json:"users"`
+		Outdated int64         `json:"outdated"`
+		ByParams []paramsCount `json:"by_params"`
+	}
+
+	if err := authenticateAdmin(cfg, r); err != nil {
+		log.Printf("GET admin password hashes: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	counts, err := cfg.dbQueries.CountPasswordHashParams(r.Context())
+	if err != nil {
+		log.Printf("GET admin password hashes: error in counting hashes: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Salt and key lengths are not counted by, so they are taken to be
+	// the configured ones.
+	response := responsePayload{
+		Params: params{
+			MemoryKiB:   cfg.passwordParams.Memory,
+			Iterations:  cfg.passwordParams.Iterations,
+			Parallelism: cfg.passwordParams.Parallelism,
+		},
+		ByParams: make([]paramsCount, 0, len(counts)),
+	}
+	for _, count := range counts {
+		p, err := auth.ParsePasswordParams(count.Params)
+		if err != nil {
+			log.Printf("GET admin password hashes: error in parsing parameters: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		p.SaltLength = cfg.passwordParams.SaltLength
+		p.KeyLength = cfg.passwordParams.KeyLength
+		outdated := auth.IsWeakerPasswordParams(p, cfg.passwordParams)
+
+		response.Users += count.Users
+		if outdated {
+			response.Outdated += count.Users
+		}
+		response.ByParams = append(response.ByParams, paramsCount{
+			params: params{
+				MemoryKiB:   p.Memory,
+				Iterations:  p.Iterations,
+				Parallelism: p.Parallelism,
+			},
+			Users:    count.Users,
+			Outdated: outdated,
+		})
+	}
+
+	jsonResponse(w, http.StatusOK, response)
+}
@@ -2,49 +2,260 @@ package main
 
 import (
 	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"crypto/subtle"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type polkaEvent string
 
-const userUpgradedEvent polkaEvent = "user.upgraded"
+const (
+	userUpgradedEvent              polkaEvent = "user.upgraded"
+	userDowngradedEvent            polkaEvent = "user.downgraded"
+	subscriptionRenewedEvent       polkaEvent = "subscription.renewed"
+	subscriptionCancelledEvent     polkaEvent = "subscription.cancelled"
+	subscriptionPaymentFailedEvent polkaEvent = "payment.failed"
+)
+
+// subscriptionPeriodDays is the length of a Chirpy Red period for events
+// that do not say when it ends.
+const subscriptionPeriodDays = 30
+
+// polkaProvider is the provider Polka events are stored under.
+const polkaProvider = "polka"
+
+// polkaSignatureHeader carries the signature of a Polka webhook, see
+// auth.SignWebhook.
+const polkaSignatureHeader = "Polka-Signature"
+
+// polkaSignatureTolerance is how far from now a Polka webhook may have
+// been signed.
+const polkaSignatureTolerance = 5 * time.Minute
+
+// maxWebhookBodySize is the largest webhook body read.
+const maxWebhookBodySize = 1 << 20
+
+// errWebhookUserNotFound is returned for events about a user that does not
+// exist. Polka does not retry them.
+var errWebhookUserNotFound = errors.New("user of the event is not found")
+
+type polkaEventPayload struct {
+	// ID is Polka's id of the event, which is the same on every delivery
+	// of it.
+	ID    string     `json:"id"`
+	Event polkaEvent `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+		// CurrentPeriodEnd is when the paid period ends, on the events
+		// that start one.
+		CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	} `json:"data"`
+}
 
 func polkaWebHooksHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
-	type requestPayload struct {
-		Event polkaEvent `json:"event"`
-		Data  struct {
-			UserID uuid.UUID `json:"user_id"`
-		} `json:"data"`
+	// The signature is over the raw body, so it is read whole before it
+	// is parsed.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		log.Printf("POST polka webhooks: error in reading request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
-
-	apiKey, err := auth.GetAPIKey(r.Header)
-	if err != nil || apiKey != cfg.polkaApiKey {
+	if err := authenticatePolkaWebhook(cfg, r, body); err != nil {
 		log.Printf("POST polka webhooks: %v\n", err)
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	request := requestPayload{}
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+	request := polkaEventPayload{}
+	if err := json.Unmarshal(body, &request); err != nil {
 		log.Printf("POST polka webhooks: error in parsing request body: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(request.ID) == 0 {
+		log.Printf("POST polka webhooks: event has no id\n")
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	if request.Event != userUpgradedEvent {
+	event, err := cfg.dbQueries.RecordWebhookEvent(r.Context(), database.RecordWebhookEventParams{
+		Provider:  polkaProvider,
+		EventID:   request.ID,
+		EventType: string(request.Event),
+		Payload:   body,
+	})
+	if err != nil {
+		log.Printf("POST polka webhooks: error in storing event: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if event.ProcessedAt.Valid {
+		// A redelivery of an event that is already applied.
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	_, err = cfg.dbQueries.UpgradeUserToRed(r.Context(), request.Data.UserID)
-	if err != nil {
-		log.Printf("POST polka webhooks: error in upgrading user to Chirpy Red: %v\n", err)
+
+	if _, err := processWebhookEvent(r.Context(), cfg, event.ID, false); errors.Is(err, errWebhookUserNotFound) {
+		log.Printf("POST polka webhooks: %v\n", err)
 		w.WriteHeader(http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Printf("POST polka webhooks: error in processing event: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// authenticatePolkaWebhook checks the signature of a Polka webhook with
+// body. In development, where a signing secret need not be configured, the
+// static API key is checked instead.
+func authenticatePolkaWebhook(cfg *apiConfig, r *http.Request, body []byte) error {
+	if len(cfg.polkaWebhookSecret) > 0 {
+		return auth.VerifyWebhookSignature(
+			r.Header.Get(polkaSignatureHeader),
+			body,
+			cfg.polkaWebhookSecret,
+			time.Now(),
+			polkaSignatureTolerance,
+		)
+	}
+	log.Printf("POST polka webhooks: no signing secret, checking the API key instead\n")
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return err
+	}
+	if len(cfg.polkaApiKey) == 0 || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaApiKey)) != 1 {
+		return errors.New("API key does not match")
+	}
+	return nil
+}
+
+// processWebhookEvent applies the stored event id, unless it is already
+// applied and replay is false. Whether it is applied or fails is recorded
+// on the event, which is returned as it was before.
+func processWebhookEvent(ctx context.Context, cfg *apiConfig, id uuid.UUID, replay bool) (database.WebhookEvent, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.WebhookEvent{}, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// The row is locked so that concurrent deliveries of the same event
+	// apply it once.
+	event, err := qtx.GetWebhookEventForUpdate(ctx, id)
+	if err != nil {
+		return database.WebhookEvent{}, fmt.Errorf("getting event: %w", err)
+	}
+	if event.ProcessedAt.Valid && !replay {
+		return event, nil
+	}
+
+	if err := applyWebhookEvent(ctx, qtx, event); err != nil {
+		tx.Rollback()
+		if markErr := cfg.dbQueries.MarkWebhookEventFailed(ctx, database.MarkWebhookEventFailedParams{
+			ID: event.ID,
+			LastError: sql.NullString{
+				String: err.Error(),
+				Valid:  true,
+			},
+		}); markErr != nil {
+			log.Printf("Error in recording webhook event failure: %v\n", markErr)
+		}
+		return event, err
+	}
+	if err := qtx.MarkWebhookEventProcessed(ctx, event.ID); err != nil {
+		return event, fmt.Errorf("marking event processed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return event, fmt.Errorf("committing transaction: %w", err)
+	}
+	return event, nil
+}
+
+// applyWebhookEvent applies event. Events that Chirpy does not act on are
+// applied by doing nothing.
+func applyWebhookEvent(ctx context.Context, q *database.Queries, event database.WebhookEvent) error {
+	if event.Provider != polkaProvider {
+		return fmt.Errorf("unknown provider %q", event.Provider)
+	}
+	payload := polkaEventPayload{}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("parsing payload: %w", err)
+	}
+
+	userID := payload.Data.UserID
+	periodEnd := sql.NullTime{}
+	if payload.Data.CurrentPeriodEnd != nil {
+		periodEnd = sql.NullTime{
+			Time:  payload.Data.CurrentPeriodEnd.UTC(),
+			Valid: true,
+		}
+	}
+
+	var rows int64
+	var err error
+	switch payload.Event {
+	case userUpgradedEvent:
+		subscription, err := q.ActivateSubscription(ctx, database.ActivateSubscriptionParams{
+			UserID:     userID,
+			PeriodEnd:  periodEnd,
+			PeriodDays: subscriptionPeriodDays,
+		})
+		if err != nil {
+			return webhookUserError(err, userID)
+		}
+		return enqueueOutboxEvent(ctx, q, outboxUserUpgraded, userID, webhookSubscription{
+			UserID:           userID,
+			Status:           subscription.Status,
+			CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+		})
+	case subscriptionRenewedEvent:
+		_, err = q.RenewSubscription(ctx, database.RenewSubscriptionParams{
+			UserID:     userID,
+			PeriodEnd:  periodEnd,
+			PeriodDays: subscriptionPeriodDays,
+		})
+		return webhookUserError(err, userID)
+	case subscriptionPaymentFailedEvent:
+		rows, err = q.MarkSubscriptionPastDue(ctx, userID)
+	case subscriptionCancelledEvent:
+		rows, err = q.CancelSubscription(ctx, userID)
+	case userDowngradedEvent:
+		rows, err = q.ExpireSubscription(ctx, userID)
+	default:
+		return nil
+	}
+	if err != nil || rows > 0 {
+		return err
+	}
+	// There was no subscription to change, which is fine unless there is
+	// no user either.
+	_, err = q.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %v", errWebhookUserNotFound, userID)
+	}
+	return err
+}
+
+// webhookUserError turns the error of writing a subscription for a user
+// that does not exist into errWebhookUserNotFound.
+func webhookUserError(err error, userID uuid.UUID) error {
+	if isPQError(err, foreignKeyViolation) {
+		return fmt.Errorf("%w: %v", errWebhookUserNotFound, userID)
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Postgres error codes the handlers react to.
+const (
+	// foreignKeyViolation is raised when a row references another row
+	// that does not exist.
+	foreignKeyViolation = "23503"
+	// uniqueViolation is raised when a row duplicates the value of a
+	// unique column.
+	uniqueViolation = "23505"
+)
+
+// isPQError reports whether err is a postgres error with the given code.
+func isPQError(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
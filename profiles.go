@@ -0,0 +1,184 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// reservedHandles are handles that could be confused with routes or with
+// staff accounts. They are compared case-insensitively.
+var reservedHandles = map[string]bool{
+	"about":    true,
+	"admin":    true,
+	"api":      true,
+	"app":      true,
+	"chirpy":   true,
+	"help":     true,
+	"login":    true,
+	"me":       true,
+	"root":     true,
+	"settings": true,
+	"staff":    true,
+	"support":  true,
+	"system":   true,
+}
+
+func validateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return errors.New("Handle must be 3 to 30 letters, digits or underscores")
+	}
+	if reservedHandles[strings.ToLower(handle)] {
+		return fmt.Errorf("Handle %q is reserved", handle)
+	}
+	// cleanChirpBody leaves mentions of existing handles as they are, so a
+	// profane handle would slip past it.
+	if profanePattern.MatchString(handle) {
+		return fmt.Errorf("Handle %q is not allowed", handle)
+	}
+	return nil
+}
+
+func getProfileHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload profile
+
+	user, err := cfg.dbQueries.GetUserByHandle(r.Context(), r.PathValue("handle"))
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonResponse(w, http.StatusNotFound, errorPayload{
+			Error: "User not found",
+		})
+		return
+	} else if err != nil {
+		log.Printf("GET profile: error in retrieving user: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	isChirpyRed, err := cfg.dbQueries.IsUserChirpyRed(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("GET profile: error in getting subscription: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, responsePayload{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt.Time,
+		Handle:      &user.Handle.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		IsChirpyRed: isChirpyRed,
+	})
+}
+
+func updateProfileHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	// Fields that are left out of the request are not changed.
+	type requestPayload struct {
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+	}
+
+	type responsePayload user
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("PATCH profile: error in getting token from authorization: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Unauthorized",
+		})
+		return
+	}
+	userID, err := authenticate(r.Context(), cfg, token, scopeProfileWrite)
+	if err != nil {
+		log.Printf("PATCH profile: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeProfileWrite)
+		return
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("PATCH profile: error decoding request body: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	params := database.UpdateUserProfileParams{
+		ID: userID,
+	}
+	if request.Handle != nil {
+		if err := validateHandle(*request.Handle); err != nil {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: err.Error(),
+			})
+			return
+		}
+		params.Handle = sql.NullString{
+			String: *request.Handle,
+			Valid:  true,
+		}
+	}
+	if request.DisplayName != nil {
+		displayName := strings.TrimSpace(*request.DisplayName)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Display name is too long",
+			})
+			return
+		}
+		params.DisplayName = sql.NullString{
+			String: displayName,
+			Valid:  true,
+		}
+	}
+	if request.Bio != nil {
+		if utf8.RuneCountInString(*request.Bio) > maxBioLength {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Bio is too long",
+			})
+			return
+		}
+		params.Bio = sql.NullString{
+			String: *request.Bio,
+			Valid:  true,
+		}
+	}
+
+	user, err := cfg.dbQueries.UpdateUserProfile(r.Context(), params)
+	if isPQError(err, uniqueViolation) {
+		jsonResponse(w, http.StatusConflict, errorPayload{
+			Error: "Handle is taken",
+		})
+		return
+	} else if err != nil {
+		log.Printf("PATCH profile: error in updating profile: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	isChirpyRed, err := cfg.dbQueries.IsUserChirpyRed(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("PATCH profile: error in getting subscription: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, responsePayload(newUser(cfg, user, isChirpyRed)))
+}
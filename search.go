@@ -0,0 +1,135 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/database"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// searchQueryToTSQuery converts a user's search string into an input for
+// postgres' to_tsquery. Terms are AND-ed together. A term within double
+// quotes is matched as a phrase and a term ending in `*` is matched as a
+// prefix. Every character that is not a letter or a digit is dropped, so
+// the result can never be a malformed tsquery.
+func searchQueryToTSQuery(q string) string {
+	terms := []string{}
+	for i, segment := range strings.Split(q, `"`) {
+		// Segments at odd indices are enclosed in double quotes.
+		if i%2 == 1 {
+			if term := tsQueryTerm(segment, false); len(term) > 0 {
+				terms = append(terms, term)
+			}
+			continue
+		}
+		for _, field := range strings.Fields(segment) {
+			prefix := strings.HasSuffix(field, "*")
+			if term := tsQueryTerm(field, prefix); len(term) > 0 {
+				terms = append(terms, term)
+			}
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// tsQueryTerm returns the words of s as a phrase, that is, joined by the
+// followed-by operator.
+func tsQueryTerm(s string, prefix bool) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	if prefix {
+		words[len(words)-1] += ":*"
+	}
+	if len(words) == 1 {
+		return words[0]
+	}
+	return "(" + strings.Join(words, " <-> ") + ")"
+}
+
+func searchChirpsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayloadItem chirpSearchResult
+
+	viewerID := optionalBearerUserID(cfg, r)
+
+	query := r.URL.Query()
+
+	tsQuery := searchQueryToTSQuery(query.Get("q"))
+	if len(tsQuery) == 0 {
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Search query is empty",
+		})
+		return
+	}
+
+	var authorID uuid.NullUUID
+	if authorIDString := query.Get("author_id"); len(authorIDString) > 0 {
+		id, err := uuid.Parse(authorIDString)
+		if err != nil {
+			log.Printf("GET chirps search: error in parsing author ID: %v\n", err)
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Invalid author_id",
+			})
+			return
+		}
+		authorID = uuid.NullUUID{
+			UUID:  id,
+			Valid: true,
+		}
+	}
+
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET chirps search: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+
+	results, err := cfg.dbQueries.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query:    tsQuery,
+		AuthorID: authorID,
+		RowLimit: limit,
+	})
+	if err != nil {
+		log.Printf("GET chirps search: error in searching chirps: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	chirps := make([]database.Chirp, 0, len(results))
+	for _, result := range results {
+		chirps = append(chirps, database.Chirp{
+			ID:           result.ID,
+			UserID:       result.UserID,
+			CreatedAt:    result.CreatedAt,
+			UpdatedAt:    result.UpdatedAt,
+			Body:         result.Body,
+			SearchVector: result.SearchVector,
+			InReplyTo:    result.InReplyTo,
+		})
+	}
+	converted, err := chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, viewerID), chirps)
+	if err != nil {
+		log.Printf("GET chirps search: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]responsePayloadItem, 0, len(results))
+	for i, result := range results {
+		response = append(response, responsePayloadItem{
+			chirp:   converted[i],
+			Rank:    result.Rank,
+			Snippet: result.Snippet,
+		})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
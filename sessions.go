@@ -0,0 +1,181 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	// ClientID is the OAuth client the session is granted to, if any.
+	ClientID *string `json:"client_id,omitempty"`
+}
+
+func newSession(s database.Session) session {
+	response := session{
+		ID:         s.ID,
+		CreatedAt:  s.CreatedAt,
+		LastUsedAt: s.LastUsedAt,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IpAddress,
+	}
+	if s.ClientID.Valid {
+		response.ClientID = &s.ClientID.String
+	}
+	return response
+}
+
+// remoteIP returns the host part of the request's remote address. Proxy
+// headers are not trusted, as anyone can set them.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func listSessionsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("GET sessions: error in getting bearer token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("GET sessions: error in validating JWT: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := cfg.dbQueries.GetActiveSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("GET sessions: error in getting sessions: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]session, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, newSession(s))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+func revokeSessionHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("DELETE session: error in getting bearer token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("DELETE session: error in validating JWT: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		log.Printf("DELETE session: error in parsing session ID: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid session ID",
+		})
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("DELETE session: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// The session is looked up by its owner too, so that someone else's
+	// session is as good as missing.
+	revoked, err := qtx.RevokeSession(r.Context(), database.RevokeSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("DELETE session: error in revoking session: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		log.Printf("DELETE session: session %v of user %v not found\n", sessionID, userID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if _, err := qtx.RevokeRefreshTokenFamily(r.Context(), sessionID); err != nil {
+		log.Printf("DELETE session: error in revoking refresh tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("DELETE session: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func revokeAllSessionsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST revoke all sessions: error in getting bearer token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("POST revoke all sessions: error in validating JWT: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("POST revoke all sessions: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if err := qtx.RevokeAllSessions(r.Context(), userID); err != nil {
+		log.Printf("POST revoke all sessions: error in revoking sessions: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := qtx.RevokeAllRefreshTokens(r.Context(), uuid.NullUUID{
+		UUID:  userID,
+		Valid: true,
+	}); err != nil {
+		log.Printf("POST revoke all sessions: error in revoking refresh tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("POST revoke all sessions: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,31 @@
+-- name: AddChirpHashtags :exec
+insert into chirp_hashtags (chirp_id, tag, created_at)
+select sqlc.arg('chirp_id'), unnest(sqlc.arg('tags')::text[]), sqlc.arg('created_at')
+on conflict (chirp_id, tag) do nothing;
+
+-- name: DeleteChirpHashtags :exec
+delete from chirp_hashtags
+where chirp_id = $1;
+
+-- name: GetHashtagChirps :many
+select chirps.*
+from chirp_hashtags
+join chirps on chirps.id = chirp_hashtags.chirp_id
+where chirp_hashtags.tag = sqlc.arg('tag')
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (chirp_hashtags.created_at, chirp_hashtags.chirp_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by chirp_hashtags.created_at desc, chirp_hashtags.chirp_id desc
+limit sqlc.arg('row_limit');
+
+-- name: GetTrendingHashtags :many
+select
+    tag,
+    count(*) as uses,
+    sum(exp(-extract(epoch from (now() - created_at)) / sqlc.arg('decay_seconds')::float8))::float8 as score
+from chirp_hashtags
+where created_at >= now() - make_interval(secs => sqlc.arg('window_seconds')::float8)
+group by tag
+order by score desc, tag
+limit sqlc.arg('row_limit');
@@ -0,0 +1,28 @@
+-- name: LikeChirp :execrows
+insert into chirp_likes (user_id, chirp_id, created_at)
+values ($1, $2, now())
+on conflict (user_id, chirp_id) do nothing;
+
+-- name: UnlikeChirp :execrows
+delete from chirp_likes
+where user_id = $1 and chirp_id = $2;
+
+-- name: GetChirpLikes :many
+select *
+from chirp_likes
+where chirp_id = sqlc.arg('chirp_id')
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (created_at, user_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_user_id')::uuid)
+    )
+order by created_at desc, user_id desc
+limit sqlc.arg('row_limit');
+
+-- name: GetChirpLikeStats :many
+select
+    chirp_id,
+    count(*) as like_count,
+    coalesce(bool_or(user_id = sqlc.narg('viewer_id')::uuid), false)::boolean as liked_by_viewer
+from chirp_likes
+where chirp_id = any(sqlc.arg('chirp_ids')::uuid[])
+group by chirp_id;
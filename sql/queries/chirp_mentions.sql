@@ -0,0 +1,34 @@
+-- name: AddChirpMentions :exec
+insert into chirp_mentions (chirp_id, user_id, start_offset, end_offset, created_at)
+select
+    sqlc.arg('chirp_id'),
+    unnest(sqlc.arg('user_ids')::uuid[]),
+    unnest(sqlc.arg('start_offsets')::integer[]),
+    unnest(sqlc.arg('end_offsets')::integer[]),
+    sqlc.arg('created_at');
+
+-- name: DeleteChirpMentions :exec
+delete from chirp_mentions
+where chirp_id = $1;
+
+-- name: GetChirpMentions :many
+select chirp_mentions.chirp_id, chirp_mentions.user_id, chirp_mentions.start_offset, chirp_mentions.end_offset, users.handle
+from chirp_mentions
+join users on users.id = chirp_mentions.user_id
+where chirp_mentions.chirp_id = any(sqlc.arg('chirp_ids')::uuid[])
+order by chirp_mentions.chirp_id, chirp_mentions.start_offset;
+
+-- name: GetMentionChirps :many
+select *
+from chirps
+where id in (
+        select chirp_id
+        from chirp_mentions
+        where chirp_mentions.user_id = sqlc.arg('user_id')
+    )
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by created_at desc, id desc
+limit sqlc.arg('row_limit');
@@ -0,0 +1,11 @@
+-- name: CreateChirpRevision :one
+insert into chirp_revisions (id, chirp_id, created_at, body)
+values (gen_random_uuid(), $1, now(), $2)
+
+returning *;
+
+-- name: GetChirpRevisions :many
+select *
+from chirp_revisions
+where chirp_id = $1
+order by created_at desc, id desc;
@@ -1,6 +1,6 @@
 -- name: CreateChirp :one
-insert into chirps (id, created_at, updated_at, body, user_id)
-values (gen_random_uuid(), now(), now(), $1, $2)
+insert into chirps (id, created_at, updated_at, body, user_id, in_reply_to)
+values (gen_random_uuid(), now(), now(), $1, $2, $3)
 
 returning *;
 
@@ -9,6 +9,24 @@ select *
 from chirps
 order by created_at;
 
+-- name: SearchChirps :many
+-- The body is HTML-escaped before it is highlighted, so that the <mark>
+-- tags are the only markup in the snippet.
+select
+    chirps.*,
+    ts_rank(chirps.search_vector, query)::real as rank,
+    ts_headline(
+        'english',
+        replace(replace(replace(coalesce(chirps.body, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2'
+    )::text as snippet
+from chirps, to_tsquery('english', sqlc.arg('query')) query
+where chirps.search_vector @@ query
+    and (sqlc.narg('author_id')::uuid is null or chirps.user_id = sqlc.narg('author_id')::uuid)
+order by rank desc, chirps.created_at desc, chirps.id desc
+limit sqlc.arg('row_limit');
+
 -- name: GetChirp :one
 select *
 from chirps
@@ -23,3 +41,113 @@ select *
 from chirps
 where user_id = $1
 order by created_at;
+
+-- name: ListChirpsAscending :many
+select *
+from chirps
+where (sqlc.narg('author_id')::uuid is null or user_id = sqlc.narg('author_id')::uuid)
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by created_at asc, id asc
+limit sqlc.arg('row_limit');
+
+-- name: ListChirpsDescending :many
+select *
+from chirps
+where (sqlc.narg('author_id')::uuid is null or user_id = sqlc.narg('author_id')::uuid)
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by created_at desc, id desc
+limit sqlc.arg('row_limit');
+
+-- name: GetChirpForUpdate :one
+select *
+from chirps
+where id = $1
+for update;
+
+-- name: UpdateChirpBody :one
+update chirps
+set body = $2, updated_at = now()
+where id = $1
+
+returning *;
+
+-- name: CountChirpReplies :many
+select in_reply_to, count(*) as reply_count
+from chirps
+where in_reply_to = any(sqlc.arg('chirp_ids')::uuid[])
+group by in_reply_to;
+
+-- name: CountRecentChirps :one
+-- Counts the chirps of a user within the last window_seconds, and how
+-- long until the earliest of them is out of it.
+select
+    count(*) as chirp_count,
+    coalesce(
+        extract(epoch from min(created_at) + make_interval(secs => sqlc.arg('window_seconds')::float) - now()),
+        0
+    )::float as retry_after_seconds
+from chirps
+where
+    user_id = sqlc.arg('user_id')
+    and created_at > now() - make_interval(secs => sqlc.arg('window_seconds')::float);
+
+-- name: GetChirpAncestors :many
+with recursive ancestors (id, in_reply_to, depth) as (
+    select parent.id, parent.in_reply_to, 1
+    from chirps child
+    join chirps parent on parent.id = child.in_reply_to
+    where child.id = sqlc.arg('chirp_id')
+    union all
+    select parent.id, parent.in_reply_to, ancestors.depth + 1
+    from ancestors
+    join chirps parent on parent.id = ancestors.in_reply_to
+    where ancestors.depth < sqlc.arg('max_depth')::int
+)
+select chirps.*
+from ancestors
+join chirps on chirps.id = ancestors.id
+order by ancestors.depth desc;
+
+-- name: GetChirpDescendants :many
+with recursive descendants (id, depth) as (
+    select id, 1
+    from chirps
+    where in_reply_to = sqlc.arg('chirp_id')
+    union all
+    select replies.id, descendants.depth + 1
+    from descendants
+    join chirps replies on replies.in_reply_to = descendants.id
+    where descendants.depth < sqlc.arg('max_depth')::int
+)
+select chirps.*, descendants.depth::int as depth
+from descendants
+join chirps on chirps.id = descendants.id
+where sqlc.narg('cursor_depth')::int is null
+    or (descendants.depth, chirps.created_at, chirps.id) > (
+        sqlc.narg('cursor_depth')::int,
+        sqlc.narg('cursor_created_at')::timestamp,
+        sqlc.narg('cursor_id')::uuid
+    )
+order by descendants.depth, chirps.created_at, chirps.id
+limit sqlc.arg('row_limit');
+
+-- name: GetTimelineChirps :many
+select *
+from chirps
+where user_id in (
+        select followee_id
+        from follows
+        where follower_id = sqlc.arg('follower_id')
+    )
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by created_at desc, id desc
+limit sqlc.arg('row_limit');
@@ -0,0 +1,30 @@
+-- name: FollowUser :execrows
+insert into follows (follower_id, followee_id, created_at)
+values ($1, $2, now())
+on conflict (follower_id, followee_id) do nothing;
+
+-- name: UnfollowUser :execrows
+delete from follows
+where follower_id = $1 and followee_id = $2;
+
+-- name: GetFollowers :many
+select *
+from follows
+where followee_id = sqlc.arg('user_id')
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (created_at, follower_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by created_at desc, follower_id desc
+limit sqlc.arg('row_limit');
+
+-- name: GetFollowing :many
+select *
+from follows
+where follower_id = sqlc.arg('user_id')
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (created_at, followee_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by created_at desc, followee_id desc
+limit sqlc.arg('row_limit');
@@ -0,0 +1,26 @@
+-- name: GetLoginLockout :one
+select coalesce(ceil(extract(epoch from max(locked_until) - now())), 0)::bigint as retry_after_seconds
+from login_throttles
+where key = any(sqlc.arg('keys')::text[]) and locked_until > now();
+
+-- name: RecordLoginFailure :one
+insert into login_throttles (key, failures, last_failure_at)
+values (sqlc.arg('key'), 1, now())
+on conflict (key) do update
+set
+    failures = case
+        when login_throttles.last_failure_at < now() - make_interval(secs => sqlc.arg('window_seconds')::float8) then 1
+        else login_throttles.failures + 1
+    end,
+    last_failure_at = now()
+
+returning failures;
+
+-- name: LockLogin :exec
+update login_throttles
+set locked_until = now() + make_interval(secs => sqlc.arg('lockout_seconds')::float8)
+where key = sqlc.arg('key');
+
+-- name: DeleteLoginThrottle :execrows
+delete from login_throttles
+where key = $1;
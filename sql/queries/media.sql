@@ -0,0 +1,18 @@
+-- name: CreateMedia :one
+insert into media (id, user_id, created_at, storage_key, content_type, size_bytes, width, height, alt_text)
+values ($1, $2, now(), $3, $4, $5, $6, $7, $8)
+
+returning *;
+
+-- name: AttachMediaToChirp :execrows
+update media
+set chirp_id = sqlc.arg('chirp_id'), position = array_position(sqlc.arg('media_ids')::uuid[], id)
+where id = any(sqlc.arg('media_ids')::uuid[])
+    and user_id = sqlc.arg('user_id')
+    and chirp_id is null;
+
+-- name: GetChirpMedia :many
+select *
+from media
+where chirp_id = any(sqlc.arg('chirp_ids')::uuid[])
+order by chirp_id, position;
@@ -0,0 +1,46 @@
+-- name: CreateOAuthClient :one
+insert into oauth_clients (id, owner_id, name, secret_hash, redirect_uris, scopes, created_at)
+values ($1, $2, $3, $4, $5, $6, now())
+
+returning *;
+
+-- name: GetOAuthClient :one
+select *
+from oauth_clients
+where id = $1;
+
+-- name: ListOAuthClients :many
+select *
+from oauth_clients
+where owner_id = $1
+order by created_at desc;
+
+-- name: DeleteOAuthClient :execrows
+delete from oauth_clients
+where id = $1 and owner_id = $2;
+
+-- name: CreateAuthorizationCode :exec
+insert into oauth_authorization_codes (
+    code_hash,
+    client_id,
+    user_id,
+    redirect_uri,
+    redirect_uri_given,
+    scopes,
+    code_challenge,
+    created_at,
+    expires_at
+)
+values ($1, $2, $3, $4, $5, $6, $7, now(), now() + interval '10 minutes');
+
+-- name: GetAuthorizationCodeForUpdate :one
+select *
+from oauth_authorization_codes
+where code_hash = $1
+for update;
+
+-- name: UseAuthorizationCode :execrows
+update oauth_authorization_codes
+set used_at = now(), session_id = $2
+where code_hash = $1 and used_at is null and now() <= expires_at;
+
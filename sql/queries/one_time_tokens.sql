@@ -0,0 +1,22 @@
+-- name: CreateOneTimeToken :exec
+insert into one_time_tokens (id, user_id, purpose, email, created_at, expires_at)
+values (
+    sqlc.arg('id'),
+    sqlc.arg('user_id'),
+    sqlc.arg('purpose'),
+    sqlc.arg('email'),
+    now(),
+    now() + make_interval(secs => sqlc.arg('expires_in_seconds')::float8)
+);
+
+-- name: UseOneTimeToken :one
+update one_time_tokens
+set used_at = now()
+where id = $1 and purpose = $2 and used_at is null and now() <= expires_at
+
+returning *;
+
+-- name: UseAllOneTimeTokens :exec
+update one_time_tokens
+set used_at = now()
+where user_id = $1 and purpose = $2 and used_at is null;
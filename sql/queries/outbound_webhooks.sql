@@ -0,0 +1,182 @@
+-- name: CreateWebhookEndpoint :one
+insert into webhook_endpoints (id, user_id, url, event_types, secret, created_at, updated_at)
+values (gen_random_uuid(), $1, $2, $3, $4, now(), now())
+
+returning *;
+
+-- name: ListWebhookEndpoints :many
+-- Lists the endpoints of user_id, or every endpoint when it is null.
+select *
+from webhook_endpoints
+where sqlc.narg('user_id')::uuid is null or user_id = sqlc.narg('user_id')::uuid
+order by created_at, id;
+
+-- name: GetWebhookEndpoint :one
+select *
+from webhook_endpoints
+where id = sqlc.arg('id') and (sqlc.narg('user_id')::uuid is null or user_id = sqlc.narg('user_id')::uuid);
+
+-- name: DeleteWebhookEndpoint :execrows
+delete from webhook_endpoints
+where id = sqlc.arg('id') and (sqlc.narg('user_id')::uuid is null or user_id = sqlc.narg('user_id')::uuid);
+
+-- name: EnableWebhookEndpoint :one
+update webhook_endpoints
+set disabled_at = null, consecutive_failures = 0, updated_at = now()
+where id = sqlc.arg('id') and (sqlc.narg('user_id')::uuid is null or user_id = sqlc.narg('user_id')::uuid)
+
+returning *;
+
+-- name: RecordWebhookEndpointFailure :one
+-- Counts a failed attempt against an endpoint, and disables it once
+-- max_failures have failed in a row.
+update webhook_endpoints
+set
+    consecutive_failures = consecutive_failures + 1,
+    disabled_at = case
+        when consecutive_failures + 1 >= sqlc.arg('max_failures')::int then coalesce(disabled_at, now())
+        else disabled_at
+    end,
+    updated_at = now()
+where id = sqlc.arg('id')
+
+returning *;
+
+-- name: ResetWebhookEndpointFailures :exec
+update webhook_endpoints
+set consecutive_failures = 0, updated_at = now()
+where id = $1 and consecutive_failures > 0;
+
+-- name: CreateOutboxEvent :exec
+insert into outbox_events (id, event_type, user_id, payload, created_at)
+values (gen_random_uuid(), $1, $2, $3, now());
+
+-- name: ClaimOutboxEvents :many
+-- Takes the oldest events that are not dispatched yet, skipping those
+-- another dispatcher has taken.
+select *
+from outbox_events
+where dispatched_at is null
+order by created_at
+limit $1
+for update skip locked;
+
+-- name: GetOutboxWatermark :one
+-- Returns the oldest transaction that may still be running. Every
+-- transaction before it has ended, so their events are all there is.
+select pg_snapshot_xmin(pg_current_snapshot())::text::bigint as xid;
+
+-- name: ListOutboxEventsBetween :many
+-- Lists the events of event_types after after_seq, of the transactions from
+-- from_xid up to before_xid, in order.
+select *
+from outbox_events
+where xid >= sqlc.arg('from_xid')::bigint::text::xid8
+    and xid < sqlc.arg('before_xid')::bigint::text::xid8
+    and seq > sqlc.arg('after_seq')
+    and event_type = any(sqlc.arg('event_types')::text[])
+order by seq
+limit sqlc.arg('row_limit');
+
+-- name: MarkOutboxEventDispatched :exec
+update outbox_events
+set dispatched_at = now()
+where id = $1;
+
+-- name: DeleteDispatchedOutboxEvents :execrows
+-- Removes events dispatched longer than retention_seconds ago, along with
+-- their deliveries, once none of those is pending.
+delete from outbox_events
+where dispatched_at < now() - make_interval(secs => sqlc.arg('retention_seconds')::float)
+    and not exists (
+        select 1
+        from webhook_deliveries
+        where webhook_deliveries.event_id = outbox_events.id and webhook_deliveries.status = 'pending'
+    );
+
+-- name: CreateWebhookDeliveries :execrows
+-- Queues an event for every enabled endpoint that receives it.
+insert into webhook_deliveries (id, endpoint_id, event_id, next_attempt_at, created_at, updated_at)
+select gen_random_uuid(), webhook_endpoints.id, sqlc.arg('event_id')::uuid, now(), now(), now()
+from webhook_endpoints
+where webhook_endpoints.disabled_at is null
+    and sqlc.arg('event_type')::text = any(webhook_endpoints.event_types)
+    and (webhook_endpoints.user_id is null or webhook_endpoints.user_id = sqlc.narg('user_id')::uuid)
+on conflict (endpoint_id, event_id) do nothing;
+
+-- name: ClaimDueWebhookDeliveries :many
+-- Takes pending deliveries that are due, to enabled endpoints, for
+-- lease_seconds. If they are not recorded as attempted by then, they are
+-- due again.
+with claimed as (
+    update webhook_deliveries
+    set next_attempt_at = now() + make_interval(secs => sqlc.arg('lease_seconds')::float), updated_at = now()
+    where webhook_deliveries.id in (
+        select webhook_deliveries.id
+        from webhook_deliveries
+        join webhook_endpoints on webhook_endpoints.id = webhook_deliveries.endpoint_id
+        where webhook_deliveries.status = 'pending'
+            and webhook_deliveries.next_attempt_at <= now()
+            and webhook_endpoints.disabled_at is null
+        order by webhook_deliveries.next_attempt_at
+        limit sqlc.arg('row_limit')
+        for update of webhook_deliveries skip locked
+    )
+    returning webhook_deliveries.id, webhook_deliveries.endpoint_id, webhook_deliveries.event_id, webhook_deliveries.attempts
+)
+select
+    claimed.id,
+    claimed.endpoint_id,
+    claimed.attempts,
+    webhook_endpoints.url,
+    webhook_endpoints.secret,
+    webhook_endpoints.user_id,
+    outbox_events.id as event_id,
+    outbox_events.event_type,
+    outbox_events.payload,
+    outbox_events.created_at as event_created_at
+from claimed
+join webhook_endpoints on webhook_endpoints.id = claimed.endpoint_id
+join outbox_events on outbox_events.id = claimed.event_id;
+
+-- name: MarkWebhookDeliverySucceeded :exec
+update webhook_deliveries
+set status = 'succeeded', attempts = attempts + 1, updated_at = now()
+where id = $1;
+
+-- name: MarkWebhookDeliveryFailed :exec
+-- Counts a failed attempt at a delivery. It is given up on after
+-- max_attempts, and is otherwise due again in retry_after_seconds.
+update webhook_deliveries
+set
+    attempts = attempts + 1,
+    status = case when attempts + 1 >= sqlc.arg('max_attempts')::int then 'failed' else 'pending' end,
+    next_attempt_at = now() + make_interval(secs => sqlc.arg('retry_after_seconds')::float),
+    updated_at = now()
+where id = sqlc.arg('id');
+
+-- name: RecordWebhookDeliveryAttempt :exec
+insert into webhook_delivery_attempts (id, delivery_id, attempted_at, status_code, error, duration_ms)
+values (gen_random_uuid(), $1, now(), $2, $3, $4);
+
+-- name: ListWebhookDeliveryAttempts :many
+select
+    webhook_delivery_attempts.id,
+    webhook_delivery_attempts.delivery_id,
+    webhook_deliveries.event_id,
+    outbox_events.event_type,
+    webhook_delivery_attempts.attempted_at,
+    webhook_delivery_attempts.status_code,
+    webhook_delivery_attempts.error,
+    webhook_delivery_attempts.duration_ms
+from webhook_delivery_attempts
+join webhook_deliveries on webhook_deliveries.id = webhook_delivery_attempts.delivery_id
+join outbox_events on outbox_events.id = webhook_deliveries.event_id
+where webhook_deliveries.endpoint_id = sqlc.arg('endpoint_id')
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (webhook_delivery_attempts.attempted_at, webhook_delivery_attempts.id)
+            < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by webhook_delivery_attempts.attempted_at desc, webhook_delivery_attempts.id desc
+limit sqlc.arg('row_limit');
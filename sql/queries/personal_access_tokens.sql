@@ -0,0 +1,37 @@
+-- name: CreatePersonalAccessToken :one
+insert into personal_access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at)
+values (gen_random_uuid(), $1, $2, $3, $4, now(), $5)
+
+returning *;
+
+-- name: GetPersonalAccessTokenByHash :one
+select *
+from personal_access_tokens
+where token_hash = $1
+    and revoked_at is null
+    and (expires_at is null or now() <= expires_at);
+
+-- name: ListPersonalAccessTokens :many
+select *
+from personal_access_tokens
+where user_id = $1
+    and revoked_at is null
+    and (expires_at is null or now() <= expires_at)
+order by created_at desc;
+
+-- name: TouchPersonalAccessToken :exec
+-- Only updated once a minute, so that busy tokens do not cost a write
+-- per request.
+update personal_access_tokens
+set last_used_at = now()
+where id = $1 and (last_used_at is null or last_used_at < now() - interval '1 minute');
+
+-- name: RevokeAllPersonalAccessTokens :exec
+update personal_access_tokens
+set revoked_at = now()
+where user_id = $1 and revoked_at is null;
+
+-- name: RevokePersonalAccessToken :execrows
+update personal_access_tokens
+set revoked_at = now()
+where id = $1 and user_id = $2 and revoked_at is null;
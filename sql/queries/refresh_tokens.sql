@@ -1,6 +1,6 @@
 -- name: CreateRefreshToken :one
-insert into refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
-values ($1, now(), now(), $2, now() + interval '60 days', null)
+insert into refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+values ($1, now(), now(), $2, now() + interval '60 days', null, $3)
 
 returning *;
 
@@ -15,3 +15,24 @@ set revoked_at = now(), updated_at = now()
 where token = $1
 
 returning *;
+
+-- name: GetRefreshTokenForUpdate :one
+select *
+from refresh_tokens
+where token = $1
+for update;
+
+-- name: RotateRefreshToken :exec
+update refresh_tokens
+set revoked_at = now(), rotated_at = now(), updated_at = now()
+where token = $1;
+
+-- name: RevokeRefreshTokenFamily :execrows
+update refresh_tokens
+set revoked_at = now(), updated_at = now()
+where family_id = $1 and revoked_at is null;
+
+-- name: RevokeAllRefreshTokens :exec
+update refresh_tokens
+set revoked_at = now(), updated_at = now()
+where user_id = $1 and revoked_at is null;
@@ -0,0 +1,39 @@
+-- name: CreateSession :one
+insert into sessions (id, user_id, created_at, last_used_at, user_agent, ip_address, client_id, scopes)
+values ($1, $2, now(), now(), $3, $4, $5, $6)
+
+returning *;
+
+-- name: GetSession :one
+select *
+from sessions
+where id = $1;
+
+-- name: TouchSession :exec
+update sessions
+set last_used_at = now(), user_agent = $2, ip_address = $3
+where id = $1;
+
+-- name: GetActiveSessions :many
+select *
+from sessions
+where user_id = $1
+    and revoked_at is null
+    and exists (
+        select 1
+        from refresh_tokens
+        where refresh_tokens.family_id = sessions.id
+            and refresh_tokens.revoked_at is null
+            and now() <= refresh_tokens.expires_at
+    )
+order by last_used_at desc;
+
+-- name: RevokeSession :execrows
+update sessions
+set revoked_at = now()
+where id = $1 and user_id = $2 and revoked_at is null;
+
+-- name: RevokeAllSessions :exec
+update sessions
+set revoked_at = now()
+where user_id = $1 and revoked_at is null;
@@ -0,0 +1,82 @@
+-- name: GetSubscription :one
+select *
+from subscriptions
+where user_id = $1;
+
+-- name: IsUserChirpyRed :one
+select exists (
+    select 1
+    from subscriptions
+    where user_id = $1 and status <> 'expired' and now() < current_period_end
+)::boolean as is_chirpy_red;
+
+-- name: ActivateSubscription :one
+-- Starts a new period from now, unless one that ends later is running.
+insert into subscriptions (user_id, status, current_period_start, current_period_end, created_at, updated_at)
+values (
+    sqlc.arg('user_id'),
+    'active',
+    now(),
+    coalesce(sqlc.narg('period_end')::timestamp, now() + make_interval(days => sqlc.arg('period_days')::int)),
+    now(),
+    now()
+)
+on conflict (user_id) do update
+set
+    status = 'active',
+    current_period_start = case
+        when subscriptions.status <> 'expired' and now() < subscriptions.current_period_end
+            then subscriptions.current_period_start
+        else now()
+    end,
+    current_period_end = greatest(
+        case when subscriptions.status <> 'expired' then subscriptions.current_period_end end,
+        excluded.current_period_end
+    ),
+    updated_at = now()
+
+returning *;
+
+-- name: RenewSubscription :one
+-- Starts the next period where the current one ends, or from now if it
+-- has already lapsed.
+insert into subscriptions (user_id, status, current_period_start, current_period_end, created_at, updated_at)
+values (
+    sqlc.arg('user_id'),
+    'active',
+    now(),
+    coalesce(sqlc.narg('period_end')::timestamp, now() + make_interval(days => sqlc.arg('period_days')::int)),
+    now(),
+    now()
+)
+on conflict (user_id) do update
+set
+    status = 'active',
+    current_period_start = greatest(subscriptions.current_period_end, now()),
+    current_period_end = coalesce(
+        sqlc.narg('period_end')::timestamp,
+        greatest(subscriptions.current_period_end, now()) + make_interval(days => sqlc.arg('period_days')::int)
+    ),
+    updated_at = now()
+
+returning *;
+
+-- name: MarkSubscriptionPastDue :execrows
+update subscriptions
+set status = 'past_due', updated_at = now()
+where user_id = $1 and status in ('active', 'past_due');
+
+-- name: CancelSubscription :execrows
+update subscriptions
+set status = 'cancelled', updated_at = now()
+where user_id = $1 and status <> 'expired';
+
+-- name: ExpireSubscription :execrows
+update subscriptions
+set status = 'expired', current_period_end = least(current_period_end, now()), updated_at = now()
+where user_id = $1 and status <> 'expired';
+
+-- name: ExpireLapsedSubscriptions :execrows
+update subscriptions
+set status = 'expired', updated_at = now()
+where status <> 'expired' and current_period_end <= now();
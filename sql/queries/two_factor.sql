@@ -0,0 +1,44 @@
+-- name: CreatePendingUserTOTP :execrows
+insert into user_totp (user_id, secret, created_at)
+values ($1, $2, now())
+on conflict (user_id) do update
+set secret = excluded.secret, created_at = excluded.created_at, last_used_step = 0
+where user_totp.enabled_at is null;
+
+-- name: GetUserTOTP :one
+select *
+from user_totp
+where user_id = $1;
+
+-- name: GetUserTOTPForUpdate :one
+select *
+from user_totp
+where user_id = $1
+for update;
+
+-- name: EnableUserTOTP :exec
+update user_totp
+set enabled_at = now(), last_used_step = $2
+where user_id = $1;
+
+-- name: SetUserTOTPLastUsedStep :exec
+update user_totp
+set last_used_step = $2
+where user_id = $1;
+
+-- name: DeleteUserTOTP :exec
+delete from user_totp
+where user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+insert into recovery_codes (code_hash, user_id, created_at)
+values ($1, $2, now());
+
+-- name: UseRecoveryCode :execrows
+update recovery_codes
+set used_at = now()
+where code_hash = $1 and user_id = $2 and used_at is null;
+
+-- name: DeleteRecoveryCodes :exec
+delete from recovery_codes
+where user_id = $1;
@@ -0,0 +1,39 @@
+-- name: CreateOIDCLoginState :exec
+insert into oidc_login_states (state_hash, nonce, code_verifier, created_at, expires_at)
+values ($1, $2, $3, now(), now() + interval '10 minutes');
+
+-- name: UseOIDCLoginState :one
+delete from oidc_login_states
+where state_hash = $1 and now() <= expires_at
+
+returning *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+delete from oidc_login_states
+where expires_at < now();
+
+-- name: CreateUserIdentity :one
+insert into user_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+values (gen_random_uuid(), $1, $2, $3, $4, now(), now())
+
+returning *;
+
+-- name: GetUserIdentity :one
+select *
+from user_identities
+where issuer = $1 and subject = $2;
+
+-- name: TouchUserIdentity :exec
+update user_identities
+set last_login_at = now(), email = $2
+where id = $1;
+
+-- name: ListUserIdentities :many
+select *
+from user_identities
+where user_id = $1
+order by created_at;
+
+-- name: DeleteUserIdentity :execrows
+delete from user_identities
+where id = $1 and user_id = $2;
@@ -4,6 +4,12 @@ values (gen_random_uuid(), now(), now(), $1, $2)
 
 returning *;
 
+-- name: CreateUserWithVerifiedEmail :one
+insert into users (id, created_at, updated_at, email, email_verified_at)
+values (gen_random_uuid(), now(), now(), $1, now())
+
+returning *;
+
 -- name: DeleteAllUsers :exec
 delete from users
 
@@ -16,14 +22,75 @@ where email = $1;
 
 -- name: UpdateUser :one
 update users
-set email = $2, hashed_password = $3, updated_at = now()
+set
+    email = $2,
+    hashed_password = $3,
+    -- a new email has to be verified again
+    email_verified_at = case when users.email = $2 then users.email_verified_at end,
+    updated_at = now()
 where id = $1
 
 returning *;
 
--- name: UpgradeUserToRed :one
+-- name: GetUserByHandle :one
+select *
+from users
+where lower(handle) = lower(sqlc.arg('handle'));
+
+-- name: GetUserByID :one
+select *
+from users
+where id = $1;
+
+-- name: UpdateUserProfile :one
 update users
-set is_chirpy_red = true, updated_at = now()
-where id = $1
+set
+    handle = coalesce(sqlc.narg('handle'), handle),
+    display_name = coalesce(sqlc.narg('display_name'), display_name),
+    bio = coalesce(sqlc.narg('bio'), bio),
+    updated_at = now()
+where id = sqlc.arg('id')
 
 returning *;
+
+-- name: GetChirpAuthors :many
+select id, handle, display_name
+from users
+where id = any(sqlc.arg('user_ids')::uuid[]);
+
+-- name: GetUsersByHandles :many
+select id, handle
+from users
+where lower(handle) = any(sqlc.arg('handles')::text[]);
+
+-- name: LockUser :exec
+-- Locks a user's row until the end of the transaction, so that what is
+-- checked against it, such as rate limits, is checked one at a time.
+select id
+from users
+where id = $1
+for no key update;
+
+-- name: MarkUserEmailVerified :execrows
+update users
+set email_verified_at = now(), updated_at = now()
+where id = $1 and email = $2;
+
+-- name: UpdateUserPassword :exec
+update users
+set hashed_password = $2, updated_at = now()
+where id = $1;
+
+-- name: RehashUserPassword :execrows
+-- Only replaces the hash it was made from, so that a password changed in
+-- the meantime is kept.
+update users
+set hashed_password = sqlc.arg('new_hash')
+where id = sqlc.arg('id') and hashed_password = sqlc.arg('old_hash');
+
+-- name: CountPasswordHashParams :many
+select split_part(hashed_password, '$', 4)::text as params, count(*) as users
+from users
+where hashed_password like '$argon2id$%'
+group by params
+order by users desc;
@@ -0,0 +1,44 @@
+-- name: RecordWebhookEvent :one
+insert into webhook_events (id, provider, event_id, event_type, payload, received_at, last_received_at)
+values (gen_random_uuid(), $1, $2, $3, $4, now(), now())
+on conflict (provider, event_id) do update
+set deliveries = webhook_events.deliveries + 1, last_received_at = now()
+
+returning *;
+
+-- name: GetWebhookEvent :one
+select *
+from webhook_events
+where id = $1;
+
+-- name: GetWebhookEventForUpdate :one
+select *
+from webhook_events
+where id = $1
+for update;
+
+-- name: MarkWebhookEventProcessed :exec
+update webhook_events
+set processed_at = now(), attempts = attempts + 1, last_error = null
+where id = $1;
+
+-- name: MarkWebhookEventFailed :exec
+update webhook_events
+set attempts = attempts + 1, last_error = $2
+where id = $1;
+
+-- name: ListWebhookEvents :many
+select *
+from webhook_events
+where (
+        sqlc.narg('status')::text is null
+        or (sqlc.narg('status')::text = 'processed' and processed_at is not null)
+        or (sqlc.narg('status')::text = 'failed' and processed_at is null and last_error is not null)
+        or (sqlc.narg('status')::text = 'pending' and processed_at is null and last_error is null)
+    )
+    and (
+        sqlc.narg('cursor_created_at')::timestamp is null
+        or (received_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+order by received_at desc, id desc
+limit sqlc.arg('row_limit');
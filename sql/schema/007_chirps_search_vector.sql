@@ -0,0 +1,12 @@
+-- +goose Up
+alter table chirps
+add column search_vector tsvector
+generated always as (to_tsvector('english', coalesce(body, ''))) stored;
+
+create index chirps_search_vector_idx on chirps using gin (search_vector);
+
+-- +goose Down
+drop index if exists chirps_search_vector_idx;
+
+alter table chirps
+drop column search_vector;
@@ -0,0 +1,11 @@
+-- +goose Up
+alter table chirps
+add column in_reply_to uuid references chirps(id) on delete set null;
+
+create index chirps_in_reply_to_idx on chirps (in_reply_to);
+
+-- +goose Down
+drop index if exists chirps_in_reply_to_idx;
+
+alter table chirps
+drop column in_reply_to;
@@ -0,0 +1,12 @@
+-- +goose Up
+create table chirp_likes (
+    user_id uuid not null references users(id) on delete cascade,
+    chirp_id uuid not null references chirps(id) on delete cascade,
+    created_at timestamp not null,
+    unique (user_id, chirp_id)
+);
+
+create index chirp_likes_chirp_id_created_at_idx on chirp_likes (chirp_id, created_at, user_id);
+
+-- +goose Down
+drop table chirp_likes;
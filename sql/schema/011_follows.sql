@@ -0,0 +1,14 @@
+-- +goose Up
+create table follows (
+    follower_id uuid not null references users(id) on delete cascade,
+    followee_id uuid not null references users(id) on delete cascade,
+    created_at timestamp not null,
+    primary key (follower_id, followee_id),
+    check (follower_id <> followee_id)
+);
+
+create index follows_follower_id_created_at_idx on follows (follower_id, created_at, followee_id);
+create index follows_followee_id_created_at_idx on follows (followee_id, created_at, follower_id);
+
+-- +goose Down
+drop table follows;
@@ -0,0 +1,15 @@
+-- +goose Up
+alter table users
+add column handle text,
+add column display_name text not null default '',
+add column bio text not null default '';
+
+create unique index users_handle_lower_idx on users (lower(handle));
+
+-- +goose Down
+drop index if exists users_handle_lower_idx;
+
+alter table users
+drop column bio,
+drop column display_name,
+drop column handle;
@@ -0,0 +1,13 @@
+-- +goose Up
+create table chirp_hashtags (
+    chirp_id uuid not null references chirps(id) on delete cascade,
+    tag text not null,
+    created_at timestamp not null,
+    primary key (chirp_id, tag)
+);
+
+create index chirp_hashtags_tag_created_at_idx on chirp_hashtags (tag, created_at, chirp_id);
+create index chirp_hashtags_created_at_idx on chirp_hashtags (created_at);
+
+-- +goose Down
+drop table chirp_hashtags;
@@ -0,0 +1,14 @@
+-- +goose Up
+create table chirp_mentions (
+    chirp_id uuid not null references chirps(id) on delete cascade,
+    user_id uuid not null references users(id) on delete cascade,
+    start_offset integer not null,
+    end_offset integer not null,
+    created_at timestamp not null,
+    primary key (chirp_id, start_offset)
+);
+
+create index chirp_mentions_user_id_created_at_idx on chirp_mentions (user_id, created_at, chirp_id);
+
+-- +goose Down
+drop table chirp_mentions;
@@ -0,0 +1,19 @@
+-- +goose Up
+create table media (
+    id uuid primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    chirp_id uuid references chirps(id) on delete cascade,
+    position integer,
+    created_at timestamp not null,
+    storage_key text not null unique,
+    content_type text not null,
+    size_bytes bigint not null,
+    width integer not null,
+    height integer not null,
+    alt_text text not null default ''
+);
+
+create index media_chirp_id_position_idx on media (chirp_id, position);
+
+-- +goose Down
+drop table media;
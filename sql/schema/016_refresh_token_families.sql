@@ -0,0 +1,20 @@
+-- +goose Up
+alter table refresh_tokens
+add column family_id uuid,
+add column rotated_at timestamp;
+
+-- Tokens issued before rotation each start their own family.
+update refresh_tokens
+set family_id = gen_random_uuid();
+
+alter table refresh_tokens
+alter column family_id set not null;
+
+create index refresh_tokens_family_id_idx on refresh_tokens (family_id);
+
+-- +goose Down
+drop index if exists refresh_tokens_family_id_idx;
+
+alter table refresh_tokens
+drop column rotated_at,
+drop column family_id;
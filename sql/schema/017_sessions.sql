@@ -0,0 +1,37 @@
+-- +goose Up
+create table sessions (
+    id uuid primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    created_at timestamp not null,
+    last_used_at timestamp not null,
+    user_agent text not null default '',
+    ip_address text not null default '',
+    revoked_at timestamp
+);
+
+create index sessions_user_id_idx on sessions (user_id);
+
+-- Refresh tokens without a user cannot be used anyway.
+delete from refresh_tokens
+where user_id is null;
+
+-- Every existing token family becomes a session of its own.
+insert into sessions (id, user_id, created_at, last_used_at, revoked_at)
+select distinct on (family_id)
+    family_id,
+    user_id,
+    coalesce(created_at, now()),
+    coalesce(updated_at, created_at, now()),
+    revoked_at
+from refresh_tokens
+order by family_id, created_at desc;
+
+alter table refresh_tokens
+add constraint refresh_tokens_family_id_fkey
+foreign key (family_id) references sessions(id) on delete cascade;
+
+-- +goose Down
+alter table refresh_tokens
+drop constraint refresh_tokens_family_id_fkey;
+
+drop table sessions;
@@ -0,0 +1,25 @@
+-- +goose Up
+create table user_totp (
+    user_id uuid primary key references users(id) on delete cascade,
+    -- encrypted with TOTP_ENCRYPTION_KEY
+    secret bytea not null,
+    created_at timestamp not null,
+    -- null until the user has confirmed they can generate codes
+    enabled_at timestamp,
+    -- the time step of the last code used, so that codes cannot be
+    -- replayed
+    last_used_step bigint not null default 0
+);
+
+create table recovery_codes (
+    code_hash text primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    created_at timestamp not null,
+    used_at timestamp
+);
+
+create index recovery_codes_user_id_idx on recovery_codes (user_id);
+
+-- +goose Down
+drop table recovery_codes;
+drop table user_totp;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Failed logins are counted per key, which is either an account (by email,
+-- whether or not it exists) or a source IP.
+create table login_throttles (
+    key text primary key,
+    failures integer not null,
+    last_failure_at timestamp not null,
+    locked_until timestamp
+);
+
+-- +goose Down
+drop table login_throttles;
@@ -0,0 +1,25 @@
+-- +goose Up
+alter table users
+add column email_verified_at timestamp;
+
+-- Tokens emailed to users, such as for verifying their email or resetting
+-- their password. A token is a JWT whose id is the id of its row here, so
+-- that it can only be used once.
+create table one_time_tokens (
+    id uuid primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    purpose text not null,
+    -- the email the token was sent to
+    email text not null,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    used_at timestamp
+);
+
+create index one_time_tokens_user_id_idx on one_time_tokens (user_id);
+
+-- +goose Down
+drop table one_time_tokens;
+
+alter table users
+drop column email_verified_at;
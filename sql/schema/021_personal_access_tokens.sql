@@ -0,0 +1,18 @@
+-- +goose Up
+create table personal_access_tokens (
+    id uuid primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    name text not null,
+    token_hash text not null unique,
+    scopes text[] not null,
+    created_at timestamp not null,
+    -- null for tokens that do not expire
+    expires_at timestamp,
+    last_used_at timestamp,
+    revoked_at timestamp
+);
+
+create index personal_access_tokens_user_id_idx on personal_access_tokens (user_id);
+
+-- +goose Down
+drop table personal_access_tokens;
@@ -0,0 +1,45 @@
+-- +goose Up
+create table oauth_clients (
+    id text primary key,
+    owner_id uuid not null references users(id) on delete cascade,
+    name text not null,
+    -- null for public clients, which cannot keep a secret
+    secret_hash text,
+    redirect_uris text[] not null,
+    -- the most a user can grant the client
+    scopes text[] not null,
+    created_at timestamp not null
+);
+
+create index oauth_clients_owner_id_idx on oauth_clients (owner_id);
+
+-- Sessions of OAuth clients are only granted some scopes. Sessions from a
+-- login have neither, and are granted every scope.
+alter table sessions
+add column client_id text references oauth_clients(id) on delete cascade,
+add column scopes text[];
+
+create table oauth_authorization_codes (
+    code_hash text primary key,
+    client_id text not null references oauth_clients(id) on delete cascade,
+    user_id uuid not null references users(id) on delete cascade,
+    redirect_uri text not null,
+    scopes text[] not null,
+    -- PKCE S256 code challenge
+    code_challenge text not null,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    -- the session the code was exchanged for, revoked if the code is
+    -- presented again
+    session_id uuid references sessions(id) on delete set null
+);
+
+-- +goose Down
+drop table oauth_authorization_codes;
+
+alter table sessions
+drop column scopes,
+drop column client_id;
+
+drop table oauth_clients;
@@ -0,0 +1,32 @@
+-- +goose Up
+-- Accounts at external OpenID Connect providers that users sign in with.
+-- A user can have a password and any number of identities.
+create table user_identities (
+    id uuid primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    issuer text not null,
+    -- the provider's id of the user, which unlike their email never
+    -- changes
+    subject text not null,
+    -- the email the provider last reported
+    email text not null,
+    created_at timestamp not null,
+    last_login_at timestamp not null,
+    unique (issuer, subject)
+);
+
+create index user_identities_user_id_idx on user_identities (user_id);
+
+-- Sign ins started with a provider and not yet come back from it.
+create table oidc_login_states (
+    state_hash text primary key,
+    nonce text not null,
+    code_verifier text not null,
+    created_at timestamp not null,
+    expires_at timestamp not null
+);
+
+-- +goose Down
+drop table oidc_login_states;
+
+drop table user_identities;
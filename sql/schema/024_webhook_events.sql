@@ -0,0 +1,24 @@
+-- +goose Up
+-- Every webhook event received, kept by the provider's id of it, so that
+-- redeliveries of an event are only applied once.
+create table webhook_events (
+    id uuid primary key,
+    provider text not null,
+    event_id text not null,
+    event_type text not null,
+    payload jsonb not null,
+    received_at timestamp not null,
+    last_received_at timestamp not null,
+    -- how many times the provider has delivered the event
+    deliveries int not null default 1,
+    processed_at timestamp,
+    -- how many times the event was applied, replays included
+    attempts int not null default 0,
+    last_error text,
+    unique (provider, event_id)
+);
+
+create index webhook_events_received_at_idx on webhook_events (received_at, id);
+
+-- +goose Down
+drop table webhook_events;
@@ -0,0 +1,42 @@
+-- +goose Up
+-- Chirpy Red memberships, paid for through Polka. A user is Chirpy Red
+-- while their subscription is not expired and its period has not ended.
+create table subscriptions (
+    user_id uuid primary key references users(id) on delete cascade,
+    -- active, past_due (a renewal payment failed), cancelled (will not
+    -- renew) or expired
+    status text not null,
+    current_period_start timestamp not null,
+    current_period_end timestamp not null,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+
+create index subscriptions_current_period_end_idx on subscriptions (current_period_end)
+where status <> 'expired';
+
+-- Users who were upgraded before subscriptions were kept were upgraded for
+-- good, as Polka did not send renewals, so they are carried over with a
+-- period that does not end. Polka's downgrade still ends it.
+insert into subscriptions (user_id, status, current_period_start, current_period_end, created_at, updated_at)
+select id, 'active', now(), timestamp '9999-12-31 00:00:00', now(), now()
+from users
+where is_chirpy_red;
+
+alter table users
+drop column is_chirpy_red;
+
+-- +goose Down
+alter table users
+add column is_chirpy_red boolean
+default false;
+
+update users
+set is_chirpy_red = true
+where id in (
+    select user_id
+    from subscriptions
+    where status <> 'expired' and now() < current_period_end
+);
+
+drop table subscriptions;
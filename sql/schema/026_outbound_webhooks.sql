@@ -0,0 +1,64 @@
+-- +goose Up
+-- Endpoints that events are sent to. Those without a user are an admin's
+-- and receive every event; a user's only receive events about them.
+create table webhook_endpoints (
+    id uuid primary key,
+    user_id uuid references users(id) on delete cascade,
+    url text not null,
+    event_types text[] not null,
+    -- kept as is, since it is needed to sign deliveries
+    secret text not null,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    -- failed attempts in a row, across deliveries
+    consecutive_failures int not null default 0,
+    disabled_at timestamp
+);
+
+create index webhook_endpoints_user_id_idx on webhook_endpoints (user_id);
+
+-- Events written in the same transaction as the change they are about, to
+-- be sent to endpoints afterwards.
+create table outbox_events (
+    id uuid primary key,
+    event_type text not null,
+    -- the user the event is about
+    user_id uuid,
+    payload jsonb not null,
+    created_at timestamp not null,
+    dispatched_at timestamp
+);
+
+create index outbox_events_undispatched_idx on outbox_events (created_at) where dispatched_at is null;
+
+create table webhook_deliveries (
+    id uuid primary key,
+    endpoint_id uuid not null references webhook_endpoints(id) on delete cascade,
+    event_id uuid not null references outbox_events(id) on delete cascade,
+    status text not null default 'pending' check (status in ('pending', 'succeeded', 'failed')),
+    attempts int not null default 0,
+    next_attempt_at timestamp not null,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    unique (endpoint_id, event_id)
+);
+
+create index webhook_deliveries_due_idx on webhook_deliveries (next_attempt_at) where status = 'pending';
+
+create table webhook_delivery_attempts (
+    id uuid primary key,
+    delivery_id uuid not null references webhook_deliveries(id) on delete cascade,
+    attempted_at timestamp not null,
+    -- null when no response was received
+    status_code int,
+    error text,
+    duration_ms int not null
+);
+
+create index webhook_delivery_attempts_delivery_id_idx on webhook_delivery_attempts (delivery_id, attempted_at);
+
+-- +goose Down
+drop table webhook_delivery_attempts;
+drop table webhook_deliveries;
+drop table outbox_events;
+drop table webhook_endpoints;
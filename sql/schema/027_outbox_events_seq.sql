@@ -0,0 +1,29 @@
+-- +goose Up
+-- seq orders events, so that a stream of them can resume after the last
+-- one it sent.
+alter table outbox_events
+add column seq bigint generated always as identity;
+
+create unique index outbox_events_seq_idx on outbox_events (seq);
+
+-- Every server is told of new events, by their seq, once they commit.
+-- +goose StatementBegin
+create function notify_outbox_event() returns trigger as $$
+begin
+    perform pg_notify('outbox_events', new.seq::text);
+    return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+create trigger outbox_events_notify
+after insert on outbox_events
+for each row execute function notify_outbox_event();
+
+-- +goose Down
+drop trigger outbox_events_notify on outbox_events;
+
+drop function notify_outbox_event();
+
+alter table outbox_events
+drop column seq;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Whether the authorization request gave the redirect URI. Only then must
+-- the token request give it too (RFC 6749, section 4.1.3).
+alter table oauth_authorization_codes
+add column redirect_uri_given boolean not null default true;
+
+-- +goose Down
+alter table oauth_authorization_codes
+drop column redirect_uri_given;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- The transaction that recorded each event. seq is taken when an event is
+-- recorded, not when it commits, so a stream cannot resume after a seq
+-- without missing events that commit late. It resumes after a transaction
+-- instead: once every transaction before one has ended, no more events of
+-- theirs can appear.
+alter table outbox_events
+add column xid xid8 not null default pg_current_xact_id();
+
+create index outbox_events_xid_idx on outbox_events (xid, seq);
+
+-- +goose Down
+alter table outbox_events
+drop column xid;
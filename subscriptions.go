@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// subscriptionExpiryInterval is how often lapsed subscriptions are looked
+// for.
+const subscriptionExpiryInterval = time.Minute
+
+// expireSubscriptionsPeriodically marks subscriptions whose period has
+// ended as expired, every interval. Chirpy Red already ends with the
+// period, see IsUserChirpyRed, so this only keeps the status in step.
+func expireSubscriptionsPeriodically(cfg *apiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		expired, err := cfg.dbQueries.ExpireLapsedSubscriptions(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Error in expiring subscriptions: %v\n", err)
+		} else if expired > 0 {
+			log.Printf("Expired %d subscriptions\n", expired)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/database"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxThreadDepth bounds how far up and down a conversation is walked.
+const maxThreadDepth = 100
+
+// threadCursor is the keyset position of the last reply of a page of a
+// thread. Replies are ordered breadth first, so the depth of the reply
+// leads the position.
+type threadCursor struct {
+	Depth int32
+	pageCursor
+}
+
+func (c threadCursor) encode() string {
+	raw := fmt.Sprintf("%d:%s", c.Depth, c.pageCursor.encode())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeThreadCursor(s string) (threadCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return threadCursor{}, errInvalidCursor
+	}
+	depthString, cursorString, found := strings.Cut(string(raw), ":")
+	if !found {
+		return threadCursor{}, errInvalidCursor
+	}
+	depth, err := strconv.ParseInt(depthString, 10, 32)
+	if err != nil {
+		return threadCursor{}, errInvalidCursor
+	}
+	cursor, err := decodePageCursor(cursorString)
+	if err != nil {
+		return threadCursor{}, err
+	}
+	return threadCursor{
+		Depth:      int32(depth),
+		pageCursor: cursor,
+	}, nil
+}
+
+func getChirpThreadHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload chirpThread
+
+	viewerID := optionalBearerUserID(cfg, r)
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("GET chirp thread: error while parsing chirp ID: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid chirp ID",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET chirp thread: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	params := database.GetChirpDescendantsParams{
+		ChirpID: uuid.NullUUID{
+			UUID:  chirpID,
+			Valid: true,
+		},
+		MaxDepth: maxThreadDepth,
+		// One extra row is fetched to know whether a next page exists.
+		RowLimit: limit + 1,
+	}
+	if cursorString := query.Get("cursor"); len(cursorString) > 0 {
+		cursor, err := decodeThreadCursor(cursorString)
+		if err != nil {
+			log.Printf("GET chirp thread: error in decoding cursor: %v\n", err)
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Invalid cursor",
+			})
+			return
+		}
+		params.CursorDepth = sql.NullInt32{
+			Int32: cursor.Depth,
+			Valid: true,
+		}
+		params.CursorCreatedAt = sql.NullTime{
+			Time:  cursor.CreatedAt,
+			Valid: true,
+		}
+		params.CursorID = uuid.NullUUID{
+			UUID:  cursor.ID,
+			Valid: true,
+		}
+	}
+
+	chirp, err := cfg.dbQueries.GetChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonResponse(w, http.StatusNotFound, errorPayload{
+			Error: "Chirp not found",
+		})
+		return
+	} else if err != nil {
+		log.Printf("GET chirp thread: error in retrieving chirp: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ancestors, err := cfg.dbQueries.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ChirpID:  chirpID,
+		MaxDepth: maxThreadDepth,
+	})
+	if err != nil {
+		log.Printf("GET chirp thread: error in retrieving ancestors: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	descendants, err := cfg.dbQueries.GetChirpDescendants(r.Context(), params)
+	if err != nil {
+		log.Printf("GET chirp thread: error in retrieving replies: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(descendants) > int(limit) {
+		descendants = descendants[:limit]
+		last := descendants[len(descendants)-1]
+		response.NextCursor = threadCursor{
+			Depth: last.Depth,
+			pageCursor: pageCursor{
+				CreatedAt: last.CreatedAt.Time,
+				ID:        last.ID,
+			},
+		}.encode()
+	}
+
+	// The thread's chirps are converted together so that their
+	// aggregates are fetched at once.
+	chirps := make([]database.Chirp, 0, len(ancestors)+1+len(descendants))
+	chirps = append(chirps, ancestors...)
+	chirps = append(chirps, chirp)
+	for _, descendant := range descendants {
+		chirps = append(chirps, database.Chirp{
+			ID:           descendant.ID,
+			UserID:       descendant.UserID,
+			CreatedAt:    descendant.CreatedAt,
+			UpdatedAt:    descendant.UpdatedAt,
+			Body:         descendant.Body,
+			SearchVector: descendant.SearchVector,
+			InReplyTo:    descendant.InReplyTo,
+		})
+	}
+	converted, err := chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, viewerID), chirps)
+	if err != nil {
+		log.Printf("GET chirp thread: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.Ancestors = converted[:len(ancestors)]
+	response.Chirp = converted[len(ancestors)]
+	response.Replies = make([]chirpReply, 0, len(descendants))
+	for i, descendant := range descendants {
+		response.Replies = append(response.Replies, chirpReply{
+			chirp: converted[len(ancestors)+1+i],
+			Depth: descendant.Depth,
+		})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
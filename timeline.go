@@ -0,0 +1,80 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func timelineHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload chirpsPage
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("GET timeline: error in getting token from authorization: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Unauthorized",
+		})
+		return
+	}
+	userID, err := authenticate(r.Context(), cfg, token, scopeChirpsRead)
+	if err != nil {
+		log.Printf("GET timeline: error in authenticating: %v\n", err)
+		writeAuthenticationError(w, err, scopeChirpsRead)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET timeline: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	cursorCreatedAt, cursorID, err := parsePageCursor(query.Get("cursor"))
+	if err != nil {
+		log.Printf("GET timeline: error in decoding cursor: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid cursor",
+		})
+		return
+	}
+
+	// One extra row is fetched to know whether a next page exists.
+	chirps, err := cfg.dbQueries.GetTimelineChirps(r.Context(), database.GetTimelineChirpsParams{
+		FollowerID:      userID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        limit + 1,
+	})
+	if err != nil {
+		log.Printf("GET timeline: error in retrieving chirps: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		response.NextCursor = pageCursor{
+			CreatedAt: last.CreatedAt.Time,
+			ID:        last.ID,
+		}.encode()
+	}
+	response.Chirps, err = chirpsResponse(r.Context(), cfg, newChirpsResponseOptions(r, uuid.NullUUID{
+		UUID:  userID,
+		Valid: true,
+	}), chirps)
+	if err != nil {
+		log.Printf("GET timeline: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/auth"
+	"ValenTheRed/chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+)
+
+var errTwoFactorUnavailable = errors.New("TOTP_ENCRYPTION_KEY is not set")
+
+// secondFactor is a TOTP code or, failing that, a recovery code.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verifySecondFactor reports whether factor passes the enabled TOTP of
+// userID. A passing factor is used up, so it must be called in a
+// transaction that is committed when it passes.
+func verifySecondFactor(
+	ctx context.Context,
+	cfg *apiConfig,
+	q *database.Queries,
+	userID uuid.UUID,
+	factor secondFactor,
+) (bool, error) {
+	// The row is locked so that concurrent requests cannot use the same
+	// code twice.
+	totp, err := q.GetUserTOTPForUpdate(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !totp.EnabledAt.Valid {
+		return false, nil
+	}
+
+	if len(factor.Code) > 0 {
+		if cfg.totpSecrets == nil {
+			return false, errTwoFactorUnavailable
+		}
+		secret, err := cfg.totpSecrets.Open(totp.Secret)
+		if err != nil {
+			return false, err
+		}
+		step, ok := auth.ValidateTOTP(secret, factor.Code, time.Now(), totp.LastUsedStep)
+		if !ok {
+			return false, nil
+		}
+		return true, q.SetUserTOTPLastUsedStep(ctx, database.SetUserTOTPLastUsedStepParams{
+			UserID:       userID,
+			LastUsedStep: step,
+		})
+	}
+	if len(factor.RecoveryCode) > 0 {
+		used, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			CodeHash: auth.HashRecoveryCode(factor.RecoveryCode),
+			UserID:   userID,
+		})
+		return used == 1, err
+	}
+	return false, nil
+}
+
+// enrollTwoFactorHandler generates a TOTP secret for the caller. It is
+// pending until confirmed with a code generated from it, and enrolling
+// again replaces a pending secret.
+func enrollTwoFactorHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST 2fa enroll: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("POST 2fa enroll: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if cfg.totpSecrets == nil {
+		log.Printf("POST 2fa enroll: %v\n", errTwoFactorUnavailable)
+		jsonResponse(w, http.StatusServiceUnavailable, errorPayload{
+			Error: "Two-factor authentication is not available",
+		})
+		return
+	}
+
+	requester, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("POST 2fa enroll: error in getting user: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := auth.MakeTOTPSecret()
+	if err != nil {
+		log.Printf("POST 2fa enroll: error in creating TOTP secret: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sealedSecret, err := cfg.totpSecrets.Seal(secret)
+	if err != nil {
+		log.Printf("POST 2fa enroll: error in encrypting TOTP secret: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	created, err := cfg.dbQueries.CreatePendingUserTOTP(r.Context(), database.CreatePendingUserTOTPParams{
+		UserID: userID,
+		Secret: sealedSecret,
+	})
+	if err != nil {
+		log.Printf("POST 2fa enroll: error in storing TOTP secret: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if created == 0 {
+		jsonResponse(w, http.StatusConflict, errorPayload{
+			Error: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, responsePayload{
+		Secret:          auth.EncodeTOTPSecret(secret),
+		ProvisioningURI: auth.TOTPProvisioningURI(secret, totpIssuer, requester.Email.String),
+	})
+}
+
+// confirmTwoFactorHandler enables the caller's pending TOTP secret once
+// they have shown a code generated from it, and hands out their recovery
+// codes. The codes are only ever shown here.
+func confirmTwoFactorHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		Code string `json:"code"`
+	}
+	type responsePayload struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("POST 2fa confirm: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("POST 2fa confirm: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if cfg.totpSecrets == nil {
+		log.Printf("POST 2fa confirm: %v\n", errTwoFactorUnavailable)
+		jsonResponse(w, http.StatusServiceUnavailable, errorPayload{
+			Error: "Two-factor authentication is not available",
+		})
+		return
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST 2fa confirm: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("POST 2fa confirm: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	totp, err := qtx.GetUserTOTPForUpdate(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonResponse(w, http.StatusNotFound, errorPayload{
+			Error: "Two-factor authentication has not been enrolled in",
+		})
+		return
+	} else if err != nil {
+		log.Printf("POST 2fa confirm: error in getting TOTP: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if totp.EnabledAt.Valid {
+		jsonResponse(w, http.StatusConflict, errorPayload{
+			Error: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+	secret, err := cfg.totpSecrets.Open(totp.Secret)
+	if err != nil {
+		log.Printf("POST 2fa confirm: error in decrypting TOTP secret: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	step, ok := auth.ValidateTOTP(secret, request.Code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Incorrect code",
+		})
+		return
+	}
+	if err := qtx.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	}); err != nil {
+		log.Printf("POST 2fa confirm: error in enabling TOTP: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		log.Printf("POST 2fa confirm: error in deleting recovery codes: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response := responsePayload{
+		RecoveryCodes: make([]string, 0, recoveryCodeCount),
+	}
+	for range recoveryCodeCount {
+		code, err := auth.MakeRecoveryCode()
+		if err != nil {
+			log.Printf("POST 2fa confirm: error in creating recovery code: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashRecoveryCode(code),
+			UserID:   userID,
+		}); err != nil {
+			log.Printf("POST 2fa confirm: error in storing recovery code: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		response.RecoveryCodes = append(response.RecoveryCodes, code)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("POST 2fa confirm: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// disableTwoFactorHandler turns two-factor authentication off. It takes a
+// second factor too, so that a stolen access token is not enough.
+func disableTwoFactorHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("DELETE 2fa: error in getting token from authorization: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("DELETE 2fa: error in validating JWT token: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	request := secondFactor{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("DELETE 2fa: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("DELETE 2fa: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	ok, err := verifySecondFactor(r.Context(), cfg, qtx, userID, request)
+	if err != nil {
+		log.Printf("DELETE 2fa: error in verifying second factor: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Incorrect code",
+		})
+		return
+	}
+	if err := qtx.DeleteUserTOTP(r.Context(), userID); err != nil {
+		log.Printf("DELETE 2fa: error in deleting TOTP: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		log.Printf("DELETE 2fa: error in deleting recovery codes: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("DELETE 2fa: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loginTwoFactorHandler is the second step of a login for users with
+// two-factor authentication enabled. It exchanges the challenge token from
+// loginHandler and a second factor for access and refresh tokens.
+func loginTwoFactorHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type requestPayload struct {
+		ChallengeToken string `json:"challenge_token"`
+		secondFactor
+	}
+	type responsePayload struct {
+		user
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	request := requestPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("POST login 2fa: error in decoding request body: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	userID, err := auth.ValidateChallengeJWT(request.ChallengeToken, cfg.jwtKeys)
+	if err != nil {
+		log.Printf("POST login 2fa: error in validating challenge token: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Unauthorized",
+		})
+		return
+	}
+
+	throttles := []loginThrottle{
+		twoFactorLoginThrottle(userID),
+		ipLoginThrottle(r),
+	}
+	if retryAfter, err := loginLockout(r.Context(), cfg, throttles...); err != nil {
+		log.Printf("POST login 2fa: error in checking login lockout: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if retryAfter > 0 {
+		writeLoginLockout(w, retryAfter)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("POST login 2fa: error in starting transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	ok, err := verifySecondFactor(r.Context(), cfg, qtx, userID, request.secondFactor)
+	if err != nil {
+		log.Printf("POST login 2fa: error in verifying second factor: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		if err := recordLoginFailure(r.Context(), cfg, throttles...); err != nil {
+			log.Printf("POST login 2fa: error in recording login failure: %v\n", err)
+		}
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Incorrect code",
+		})
+		return
+	}
+	requester, err := qtx.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("POST login 2fa: error in getting user: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("POST login 2fa: error in committing transaction: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	token, refreshToken, err := issueTokens(cfg, r, userID)
+	if err != nil {
+		log.Printf("POST login 2fa: error in issuing tokens: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if _, err := clearLoginFailures(r.Context(), cfg, throttles[0]); err != nil {
+		log.Printf("POST login 2fa: error in clearing login failures: %v\n", err)
+	}
+
+	isChirpyRed, err := cfg.dbQueries.IsUserChirpyRed(r.Context(), requester.ID)
+	if err != nil {
+		log.Printf("POST login 2fa: error in getting subscription: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, responsePayload{
+		user:         newUser(cfg, requester, isChirpyRed),
+		Token:        token,
+		RefreshToken: refreshToken,
+	})
+}
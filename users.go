@@ -27,7 +27,7 @@ func usersHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(request.Password)
+	hashedPassword, err := auth.HashPassword(request.Password, cfg.passwordParams)
 	if err != nil {
 		log.Printf("Error hashing user's password: %v\n", err)
 		jsonResponse(w, http.StatusInternalServerError, errorPayload{
@@ -51,13 +51,10 @@ func usersHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonResponse(w, http.StatusCreated, responsePayload{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
-		Email:       user.Email.String,
-		IsChirpyRed: user.IsChirpyRed.Bool,
-	})
+	sendOneTimeTokenEmailInBackground(r.Context(), cfg, user, auth.PurposeVerifyEmail)
+
+	// A new user has no subscription yet.
+	jsonResponse(w, http.StatusCreated, responsePayload(newUser(cfg, user, false)))
 }
 
 func updateUsersHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
@@ -85,7 +82,7 @@ func updateUsersHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(request.Password)
+	hashedPassword, err := auth.HashPassword(request.Password, cfg.passwordParams)
 	if err != nil {
 		log.Printf("Error in hashing the password: %v\n", err)
 		jsonResponse(w, http.StatusUnauthorized, errorPayload{
@@ -93,7 +90,7 @@ func updateUsersHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
 	if err != nil {
 		log.Printf("Error validating JWT token: %v\n", err)
 		jsonResponse(w, http.StatusUnauthorized, errorPayload{
@@ -102,6 +99,30 @@ func updateUsersHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	previous, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error in getting user: %v\n", err)
+		jsonResponse(w, http.StatusUnauthorized, errorPayload{
+			Error: "Unauthorized",
+		})
+		return
+	}
+	// A new email is sent a verification, which is throttled so that
+	// emails cannot be changed to flood someone's inbox.
+	if request.Email != previous.Email.String {
+		retryAfter, err := countThrottledRequest(r.Context(), cfg, emailVerificationThrottle(userID), ipEmailVerificationThrottle(r))
+		if err != nil {
+			log.Printf("Error in throttling email change: %v\n", err)
+			jsonResponse(w, http.StatusInternalServerError, errorPayload{
+				Error: "Something went wrong",
+			})
+			return
+		}
+		if retryAfter > 0 {
+			writeRequestLockout(w, retryAfter, tooManyEmailVerificationsMessage)
+			return
+		}
+	}
 	user, err := cfg.dbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
 		ID: userID,
 		Email: sql.NullString{
@@ -118,11 +139,50 @@ func updateUsersHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	jsonResponse(w, http.StatusOK, responsePayload{
-		ID:          userID,
-		Email:       request.Email,
-		UpdatedAt:   user.UpdatedAt.Time,
-		CreatedAt:   user.CreatedAt.Time,
-		IsChirpyRed: user.IsChirpyRed.Bool,
-	})
+	// Only a new email is sent a verification; the old one was sent one
+	// when it was set, and can ask for another.
+	if user.Email != previous.Email && !user.EmailVerifiedAt.Valid {
+		sendOneTimeTokenEmailInBackground(r.Context(), cfg, user, auth.PurposeVerifyEmail)
+	}
+
+	isChirpyRed, err := cfg.dbQueries.IsUserChirpyRed(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error in getting user's subscription: %v\n", err)
+		jsonResponse(w, http.StatusInternalServerError, errorPayload{
+			Error: "Something went wrong",
+		})
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, responsePayload(newUser(cfg, user, isChirpyRed)))
+}
+
+// newUser converts a user from the database into its API model. Whether
+// they are Chirpy Red comes from their subscription, see IsUserChirpyRed.
+func newUser(cfg *apiConfig, u database.User, isChirpyRed bool) user {
+	response := user{
+		ID:              u.ID,
+		CreatedAt:       u.CreatedAt.Time,
+		UpdatedAt:       u.UpdatedAt.Time,
+		Email:           u.Email.String,
+		IsEmailVerified: u.EmailVerifiedAt.Valid,
+		IsChirpyRed:     isChirpyRed,
+		DisplayName:     u.DisplayName,
+		Bio:             u.Bio,
+		Limits:          newLimits(cfg.limitsFor(isChirpyRed)),
+	}
+	if u.Handle.Valid {
+		response.Handle = &u.Handle.String
+	}
+	return response
+}
+
+// newLimits converts limits into their API model.
+func newLimits(l chirpLimits) limits {
+	return limits{
+		MaxChirpLength:    l.MaxChirpLength,
+		MaxChirpMedia:     l.MaxChirpMedia,
+		EditWindowSeconds: int(l.EditWindow.Seconds()),
+		ChirpsPerHour:     l.ChirpsPerHour,
+	}
 }
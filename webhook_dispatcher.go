@@ -0,0 +1,220 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/database"
+	"ValenTheRed/chirpy/internal/webhook"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// webhookDispatchInterval is how often events are looked for and
+	// deliveries that are due are sent.
+	webhookDispatchInterval = 5 * time.Second
+	// webhookBatchSize is how many events, and deliveries, are taken at a
+	// time.
+	webhookBatchSize = 100
+	// webhookTimeout is how long an endpoint has to respond.
+	webhookTimeout = 10 * time.Second
+	// webhookMaxAttempts is how many times a delivery is attempted before
+	// it is given up on. With the backoff below, that is over about four
+	// hours.
+	webhookMaxAttempts  = 10
+	webhookBackoffBase  = 30 * time.Second
+	webhookBackoffLimit = 6 * time.Hour
+	// webhookMaxFailedInARow is how many attempts to an endpoint can fail
+	// in a row, across its deliveries, before it is disabled.
+	webhookMaxFailedInARow = 50
+	// outboxRetention is how long dispatched events, and their deliveries,
+	// are kept.
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// webhookEventPayload is the body of a webhook.
+type webhookEventPayload struct {
+	ID        uuid.UUID       `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// webhookDispatcher sends the events recorded by enqueueOutboxEvent to the
+// endpoints that receive them. Deliveries are at least once and may be out
+// of order.
+type webhookDispatcher struct {
+	cfg *apiConfig
+	// userClient sends to users' endpoints, which must be public. Admins'
+	// endpoints may be internal tools, and are sent to with adminClient.
+	userClient  *http.Client
+	adminClient *http.Client
+}
+
+func newWebhookDispatcher(cfg *apiConfig) *webhookDispatcher {
+	return &webhookDispatcher{
+		cfg:         cfg,
+		userClient:  webhook.NewClient(webhookTimeout, false),
+		adminClient: webhook.NewClient(webhookTimeout, true),
+	}
+}
+
+// run dispatches every interval, and prunes old events once an hour.
+func (d *webhookDispatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastPruned time.Time
+	for range ticker.C {
+		ctx := context.Background()
+		if err := d.dispatch(ctx); err != nil {
+			log.Printf("Error in dispatching webhooks: %v\n", err)
+		}
+		if time.Since(lastPruned) < time.Hour {
+			continue
+		}
+		pruned, err := d.cfg.dbQueries.DeleteDispatchedOutboxEvents(ctx, outboxRetention.Seconds())
+		if err != nil {
+			log.Printf("Error in pruning outbox events: %v\n", err)
+			continue
+		}
+		lastPruned = time.Now()
+		if pruned > 0 {
+			log.Printf("Pruned %d outbox events\n", pruned)
+		}
+	}
+}
+
+// dispatch queues new events for their endpoints, and sends the deliveries
+// that are due.
+func (d *webhookDispatcher) dispatch(ctx context.Context) error {
+	if err := d.fanOut(ctx); err != nil {
+		return err
+	}
+
+	// Deliveries are leased for long enough to be sent, after which they
+	// are taken again, should this dispatcher have stopped meanwhile.
+	deliveries, err := d.cfg.dbQueries.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+		LeaseSeconds: (2 * webhookTimeout).Seconds(),
+		RowLimit:     webhookBatchSize,
+	})
+	if err != nil {
+		return fmt.Errorf("claiming deliveries: %w", err)
+	}
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Go(func() {
+			if err := d.deliver(ctx, delivery); err != nil {
+				log.Printf("Error in delivering webhook %v: %v\n", delivery.ID, err)
+			}
+		})
+	}
+	wg.Wait()
+	return nil
+}
+
+// fanOut queues a delivery of every new event for each endpoint that
+// receives it.
+func (d *webhookDispatcher) fanOut(ctx context.Context) error {
+	tx, err := d.cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := d.cfg.dbQueries.WithTx(tx)
+
+	events, err := qtx.ClaimOutboxEvents(ctx, webhookBatchSize)
+	if err != nil {
+		return fmt.Errorf("claiming events: %w", err)
+	}
+	for _, event := range events {
+		if _, err := qtx.CreateWebhookDeliveries(ctx, database.CreateWebhookDeliveriesParams{
+			EventID:   event.ID,
+			EventType: event.EventType,
+			UserID:    event.UserID,
+		}); err != nil {
+			return fmt.Errorf("queueing deliveries of event %v: %w", event.ID, err)
+		}
+		if err := qtx.MarkOutboxEventDispatched(ctx, event.ID); err != nil {
+			return fmt.Errorf("marking event %v dispatched: %w", event.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// deliver makes an attempt at delivery, and records how it went.
+func (d *webhookDispatcher) deliver(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow) error {
+	body, err := json.Marshal(webhookEventPayload{
+		ID:        delivery.EventID,
+		Event:     delivery.EventType,
+		CreatedAt: delivery.EventCreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding body: %w", err)
+	}
+	client := d.adminClient
+	if delivery.UserID.Valid {
+		client = d.userClient
+	}
+
+	start := time.Now()
+	status, sendErr := webhook.Send(ctx, client, webhook.Message{
+		URL:        delivery.Url,
+		Secret:     delivery.Secret,
+		DeliveryID: delivery.ID.String(),
+		Event:      delivery.EventType,
+		Body:       body,
+	}, start)
+	attempt := database.RecordWebhookDeliveryAttemptParams{
+		DeliveryID: delivery.ID,
+		DurationMs: int32(time.Since(start).Milliseconds()),
+	}
+	if status != 0 {
+		attempt.StatusCode = sql.NullInt32{Int32: int32(status), Valid: true}
+	}
+	if sendErr != nil {
+		attempt.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+	if err := d.cfg.dbQueries.RecordWebhookDeliveryAttempt(ctx, attempt); err != nil {
+		return fmt.Errorf("recording attempt: %w", err)
+	}
+
+	if sendErr == nil {
+		if err := d.cfg.dbQueries.MarkWebhookDeliverySucceeded(ctx, delivery.ID); err != nil {
+			return fmt.Errorf("marking delivery succeeded: %w", err)
+		}
+		if err := d.cfg.dbQueries.ResetWebhookEndpointFailures(ctx, delivery.EndpointID); err != nil {
+			return fmt.Errorf("resetting endpoint failures: %w", err)
+		}
+		return nil
+	}
+
+	attempts := int(delivery.Attempts) + 1
+	if err := d.cfg.dbQueries.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+		MaxAttempts:       webhookMaxAttempts,
+		RetryAfterSeconds: webhook.Backoff(attempts, webhookBackoffBase, webhookBackoffLimit).Seconds(),
+		ID:                delivery.ID,
+	}); err != nil {
+		return fmt.Errorf("marking delivery failed: %w", err)
+	}
+	endpoint, err := d.cfg.dbQueries.RecordWebhookEndpointFailure(ctx, database.RecordWebhookEndpointFailureParams{
+		MaxFailures: webhookMaxFailedInARow,
+		ID:          delivery.EndpointID,
+	})
+	if err != nil {
+		return fmt.Errorf("recording endpoint failure: %w", err)
+	}
+	if endpoint.ConsecutiveFailures == webhookMaxFailedInARow {
+		log.Printf("Webhook endpoint %v is disabled after %d failures in a row\n", endpoint.ID, endpoint.ConsecutiveFailures)
+	}
+	return nil
+}
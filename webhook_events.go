@@ -0,0 +1,165 @@
+package main
+
+import (
+	"ValenTheRed/chirpy/internal/database"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// webhookEventStatuses are what webhook events can be listed by.
+var webhookEventStatuses = []string{"processed", "failed", "pending"}
+
+func newWebhookEvent(e database.WebhookEvent) webhookEvent {
+	response := webhookEvent{
+		ID:             e.ID,
+		Provider:       e.Provider,
+		EventID:        e.EventID,
+		EventType:      e.EventType,
+		Payload:        e.Payload,
+		ReceivedAt:     e.ReceivedAt,
+		LastReceivedAt: e.LastReceivedAt,
+		Deliveries:     e.Deliveries,
+		Attempts:       e.Attempts,
+	}
+	if e.ProcessedAt.Valid {
+		response.ProcessedAt = &e.ProcessedAt.Time
+	}
+	if e.LastError.Valid {
+		response.LastError = &e.LastError.String
+	}
+	return response
+}
+
+// listWebhookEventsHandler lists received webhook events, newest first,
+// optionally only those with `?status=`.
+func listWebhookEventsHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	type responsePayload webhookEventsPage
+
+	if err := authenticateAdmin(cfg, r); err != nil {
+		log.Printf("GET admin webhook events: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	status := sql.NullString{}
+	if s := query.Get("status"); len(s) > 0 {
+		if !slices.Contains(webhookEventStatuses, s) {
+			jsonResponse(w, http.StatusBadRequest, errorPayload{
+				Error: "Invalid status",
+			})
+			return
+		}
+		status = sql.NullString{String: s, Valid: true}
+	}
+	limit, err := parsePageLimit(query.Get("limit"))
+	if err != nil {
+		log.Printf("GET admin webhook events: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid limit",
+		})
+		return
+	}
+	cursorCreatedAt, cursorID, err := parsePageCursor(query.Get("cursor"))
+	if err != nil {
+		log.Printf("GET admin webhook events: error in decoding cursor: %v\n", err)
+		jsonResponse(w, http.StatusBadRequest, errorPayload{
+			Error: "Invalid cursor",
+		})
+		return
+	}
+
+	// One extra row is fetched to know whether a next page exists.
+	events, err := cfg.dbQueries.ListWebhookEvents(r.Context(), database.ListWebhookEventsParams{
+		Status:          status,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		RowLimit:        limit + 1,
+	})
+	if err != nil {
+		log.Printf("GET admin webhook events: error in retrieving events: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := responsePayload{}
+	if len(events) > int(limit) {
+		events = events[:limit]
+		last := events[len(events)-1]
+		response.NextCursor = pageCursor{
+			CreatedAt: last.ReceivedAt,
+			ID:        last.ID,
+		}.encode()
+	}
+	response.Events = make([]webhookEvent, 0, len(events))
+	for _, e := range events {
+		response.Events = append(response.Events, newWebhookEvent(e))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+func getWebhookEventHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	if err := authenticateAdmin(cfg, r); err != nil {
+		log.Printf("GET admin webhook event: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("eventID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	event, err := cfg.dbQueries.GetWebhookEvent(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("GET admin webhook event: error in retrieving event: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, newWebhookEvent(event))
+}
+
+// replayWebhookEventHandler applies a stored event again, whether or not
+// it was applied before, such as after fixing what made it fail.
+func replayWebhookEventHandler(cfg *apiConfig, w http.ResponseWriter, r *http.Request) {
+	if err := authenticateAdmin(cfg, r); err != nil {
+		log.Printf("POST admin webhook event replay: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("eventID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	_, err = processWebhookEvent(r.Context(), cfg, id, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("POST admin webhook event replay: error in processing event: %v\n", err)
+		// The failure is recorded on the event, which is returned below.
+	}
+
+	event, getErr := cfg.dbQueries.GetWebhookEvent(r.Context(), id)
+	if getErr != nil {
+		log.Printf("POST admin webhook event replay: error in retrieving event: %v\n", getErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusUnprocessableEntity
+	}
+	jsonResponse(w, status, newWebhookEvent(event))
+}